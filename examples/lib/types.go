@@ -2,9 +2,9 @@ package lib
 
 // Define your record type
 type UserRecord struct {
-	Email         string  `csv:"email"`
+	Email         string  `csv:"email" validate:"required,email"`
 	Name          string  `csv:"name"`
-	Points        int     `csv:"points"`
-	DemeritPoints *int    `csv:"demerit_points"`
-	ProfilePhoto  *string `csv:"profile_photo"`
+	Points        int     `csv:"points" validate:"min=0"`
+	DemeritPoints *int    `csv:"demerit_points" validate:"min=0"`
+	ProfilePhoto  *string `csv:"profile_photo" validate:"omitempty,url"`
 }
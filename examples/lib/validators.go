@@ -1,22 +1,9 @@
 package lib
 
-import (
-	"fmt"
-	"net/url"
-)
+import "github.com/algebananazzzzz/planear/pkg/validate"
 
+// ValidateUserRecord checks the `validate` tags of UserRecord; combine it
+// with custom checks using validate.All.
 func ValidateUserRecord(u UserRecord) error {
-	if u.Points < 0 {
-		return fmt.Errorf("points cannot be negative")
-	}
-	if u.DemeritPoints != nil && *u.DemeritPoints < 0 {
-		return fmt.Errorf("demerit points cannot be negative")
-	}
-	if u.ProfilePhoto != nil && *u.ProfilePhoto != "" {
-		_, err := url.ParseRequestURI(*u.ProfilePhoto)
-		if err != nil {
-			return fmt.Errorf("invalid profile photo URL")
-		}
-	}
-	return nil
+	return validate.Struct(u)
 }
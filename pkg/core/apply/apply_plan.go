@@ -5,6 +5,7 @@ import (
 
 	"github.com/algebananazzzzz/planear/pkg/constants"
 	"github.com/algebananazzzzz/planear/pkg/formatters"
+	"github.com/algebananazzzzz/planear/pkg/input"
 	"github.com/algebananazzzzz/planear/pkg/types"
 	"github.com/algebananazzzzz/planear/pkg/utils"
 )
@@ -19,6 +20,38 @@ type RunParams[T any] struct {
 	OnFinalize      func() error
 	Parallelization *int
 	FinalizeOn      types.FinalizeOn
+
+	// Interpolation resolves the `${...}` references that plan.Generate
+	// stored in the plan file for interpolated cells (see Plan.Sensitive)
+	// before OnAdd and OnUpdate are called. Required when the plan has
+	// sensitive columns; the execution report still shows the references.
+	Interpolation *input.Interpolation
+
+	// LoadLocalRecords reloads the local records, keyed as in plan.Generate,
+	// so OnAdd and OnUpdate receive the real values of sensitive columns,
+	// which the plan file only stores as digests (see Plan.Digests). Required
+	// when the plan has digests; a reloaded value whose digest differs from
+	// the planned one fails the run before any callback fires.
+	LoadLocalRecords func() (map[string]T, error)
+
+	// LoadRemoteRecords reloads the remote records, keyed as in
+	// plan.Generate, for sensitive columns the CSV left unset (see
+	// Plan.Unset), whose planned values are the remote ones. Required when
+	// the plan lists such columns; a reloaded value whose digest differs
+	// from the planned one fails the run before any callback fires.
+	LoadRemoteRecords func() (map[string]T, error)
+
+	// DigestKey is the plan.GenerateParams.DigestKey the plan was generated
+	// with, if any. With a different key no digest matches.
+	DigestKey []byte
+
+	// LastAppliedPath, when set, names a JSON snapshot of the records as
+	// last applied, keyed like the plan. After the operations run, the
+	// records of every successful operation are written to it, even when
+	// others failed, and so are the plan's in-sync records (Plan.InSync)
+	// when none failed; plan.GenerateParams.LastAppliedPath reads it for a
+	// three-way diff.
+	LastAppliedPath string
 }
 
 func Run[T any](params RunParams[T]) error {
@@ -51,13 +84,31 @@ func Run[T any](params RunParams[T]) error {
 		return nil
 	}
 
+	onAdd, onUpdate := params.OnAdd, params.OnUpdate
+	if len(plan.Digests) > 0 {
+		var err error
+		onAdd, onUpdate, err = restoringCallbacks(plan, params.LoadLocalRecords, params.LoadRemoteRecords, params.DigestKey, onAdd, onUpdate)
+		if err != nil {
+			fmt.Printf("%sfailed to restore sensitive values: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+			return fmt.Errorf("failed to restore sensitive values: %v", err)
+		}
+	}
+	if len(plan.Sensitive) > 0 {
+		var err error
+		onAdd, onUpdate, err = resolvingCallbacks(plan, params.Interpolation, onAdd, onUpdate)
+		if err != nil {
+			fmt.Printf("%sfailed to resolve interpolated values: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+			return fmt.Errorf("failed to resolve interpolated values: %v", err)
+		}
+	}
+
 	// Execute DB operations
 	result, err := ExecuteOperations(ExecuteOperationsParams[T]{
 		Plan:            plan,
 		FormatRecord:    params.FormatRecord,
 		FormatKey:       params.FormatKey,
-		OnAdd:           params.OnAdd,
-		OnUpdate:        params.OnUpdate,
+		OnAdd:           onAdd,
+		OnUpdate:        onUpdate,
 		OnDelete:        params.OnDelete,
 		OnFinalize:      params.OnFinalize,
 		Parallelization: params.Parallelization,
@@ -83,6 +134,16 @@ func Run[T any](params RunParams[T]) error {
 				skippedCount, len(result.Skipped.Additions), len(result.Skipped.Updates), len(result.Skipped.Deletions))
 		}
 	}
+	if result != nil && params.LastAppliedPath != "" {
+		// In-sync records are only recorded after a fully successful run.
+		var inSync map[string]T
+		if finalErr == nil {
+			inSync = plan.InSync
+		}
+		if err := updateLastApplied(params.LastAppliedPath, result.Success, inSync, plan.Conflicts); err != nil && finalErr == nil {
+			finalErr = fmt.Errorf("failed to write last-applied snapshot: %v", err)
+		}
+	}
 
 	// Print error message if there were failures (defer ensures report is printed first)
 	defer func() {
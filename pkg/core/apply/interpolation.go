@@ -0,0 +1,70 @@
+package apply
+
+import (
+	"fmt"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// resolvingCallbacks wraps onAdd and onUpdate so they receive records whose
+// sensitive columns hold resolved values rather than the `${...}` templates
+// stored in the plan file. Every template is resolved up front, so a missing
+// variable or secret fails the run before any callback fires. The plan, and
+// therefore the execution report, keeps the templates.
+func resolvingCallbacks[T any](
+	plan types.Plan[T],
+	interp *input.Interpolation,
+	onAdd func(types.RecordAddition[T]) error,
+	onUpdate func(types.RecordUpdate[T]) error,
+) (func(types.RecordAddition[T]) error, func(types.RecordUpdate[T]) error, error) {
+	if interp == nil {
+		return nil, nil, fmt.Errorf("plan contains interpolated values; RunParams.Interpolation is required")
+	}
+
+	resolve := func(key string, rec T) (T, error) {
+		rec, err := schema.ReplaceText(rec, plan.Sensitive[key], func(_, template string) (string, error) {
+			return interp.Expand(template)
+		})
+		if err != nil {
+			return rec, fmt.Errorf("key %q: %w", key, err)
+		}
+		return rec, nil
+	}
+
+	additions := map[string]T{}
+	for _, a := range plan.Additions {
+		if _, ok := plan.Sensitive[a.Key]; ok {
+			rec, err := resolve(a.Key, a.New)
+			if err != nil {
+				return nil, nil, err
+			}
+			additions[a.Key] = rec
+		}
+	}
+	updates := map[string]T{}
+	for _, u := range plan.Updates {
+		if _, ok := plan.Sensitive[u.Key]; ok {
+			rec, err := resolve(u.Key, u.New)
+			if err != nil {
+				return nil, nil, err
+			}
+			updates[u.Key] = rec
+		}
+	}
+
+	wrappedAdd := func(a types.RecordAddition[T]) error {
+		if rec, ok := additions[a.Key]; ok {
+			a.New = rec
+		}
+		return onAdd(a)
+	}
+	wrappedUpdate := func(u types.RecordUpdate[T]) error {
+		if rec, ok := updates[u.Key]; ok {
+			u.New = rec
+		}
+		return onUpdate(u)
+	}
+	return wrappedAdd, wrappedUpdate, nil
+}
@@ -0,0 +1,79 @@
+package apply_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/core/apply"
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type Credential struct {
+	ID    string `csv:"id" json:"id"`
+	Token string `csv:"token" json:"token"`
+}
+
+func interpolatedPlan() types.Plan[Credential] {
+	return types.Plan[Credential]{
+		Additions: []types.RecordAddition[Credential]{
+			{Key: "1", New: Credential{ID: "1", Token: "${secret:one}"}},
+			{Key: "2", New: Credential{ID: "2", Token: "plain ${secret:untouched}"}},
+		},
+		Updates: []types.RecordUpdate[Credential]{
+			{Key: "3", Old: Credential{ID: "3", Token: "(sensitive)"}, New: Credential{ID: "3", Token: "Bearer ${secret:three}"}},
+		},
+		Sensitive: map[string][]string{"1": {"token"}, "3": {"token"}},
+	}
+}
+
+func TestRun_ResolvesInterpolatedValues(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", interpolatedPlan())
+
+	var mu sync.Mutex
+	tokens := map[string]string{}
+	record := func(c Credential) error {
+		mu.Lock()
+		tokens[c.ID] = c.Token
+		mu.Unlock()
+		return nil
+	}
+
+	err := apply.Run(apply.RunParams[Credential]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(c Credential) string { return c.ID + ":" + c.Token },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(a types.RecordAddition[Credential]) error { return record(a.New) },
+		OnUpdate:     func(u types.RecordUpdate[Credential]) error { return record(u.New) },
+		OnDelete:     func(types.RecordDeletion[Credential]) error { return nil },
+		Interpolation: &input.Interpolation{
+			Secrets: input.SecretResolverFunc(func(path string) (string, error) { return "<" + path + ">", nil }),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"1": "<one>",
+		"2": "plain ${secret:untouched}", // not a sensitive column, passed through as planned
+		"3": "Bearer <three>",
+	}, tokens)
+}
+
+func TestRun_InterpolatedPlanRequiresInterpolation(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", interpolatedPlan())
+
+	called := false
+	err := apply.Run(apply.RunParams[Credential]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(c Credential) string { return c.ID },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(types.RecordAddition[Credential]) error { called = true; return nil },
+		OnUpdate:     func(types.RecordUpdate[Credential]) error { called = true; return nil },
+		OnDelete:     func(types.RecordDeletion[Credential]) error { return nil },
+	})
+	assert.ErrorContains(t, err, "RunParams.Interpolation is required")
+	assert.False(t, called)
+}
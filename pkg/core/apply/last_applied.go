@@ -0,0 +1,76 @@
+package apply
+
+import (
+	"reflect"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/pkg/utils"
+)
+
+// updateLastApplied records the operations that succeeded in the snapshot at
+// path: added and updated records are stored as the CSV had them (see
+// RecordUpdate.Local), deleted ones are removed, and the inSync records
+// (see Plan.InSync) are stored like updated ones. Records of failed or
+// skipped operations keep their previous entry, so the next three-way diff
+// plans them again, and so do fields of a conflict resolved with
+// ConflictKeepRemote, so it is reported again.
+func updateLastApplied[T any](path string, success types.Plan[T], inSync map[string]T, conflicts []types.RecordConflict) error {
+	var snapshot map[string]T
+	if err := utils.ParseJSONFile(path, "last-applied snapshot", &snapshot); err != nil {
+		return err
+	}
+	if snapshot == nil {
+		snapshot = map[string]T{}
+	}
+
+	kept := map[string][]string{}
+	for _, c := range conflicts {
+		if c.Policy != types.ConflictKeepRemote {
+			continue
+		}
+		for _, f := range c.Fields {
+			kept[c.Key] = append(kept[c.Key], f.Field)
+		}
+	}
+
+	store := func(key string, rec T) {
+		if prev, ok := snapshot[key]; ok && len(kept[key]) > 0 {
+			rec = keepColumns(rec, prev, kept[key])
+		}
+		snapshot[key] = rec
+	}
+	for key, rec := range inSync {
+		store(key, rec)
+	}
+	for _, a := range success.Additions {
+		snapshot[a.Key] = a.New
+	}
+	for _, u := range success.Updates {
+		rec := u.New
+		if u.Local != nil {
+			rec = *u.Local
+		}
+		store(u.Key, rec)
+	}
+	for _, d := range success.Deletions {
+		delete(snapshot, d.Key)
+	}
+	return utils.WriteJSONFile(path, "last-applied snapshot", snapshot)
+}
+
+// keepColumns returns rec with the listed columns copied from prev.
+func keepColumns[T any](rec, prev T, columns []string) T {
+	v := reflect.ValueOf(&rec).Elem()
+	s, err := schema.For(v.Type())
+	if err != nil {
+		return rec
+	}
+	p := reflect.ValueOf(prev)
+	for _, column := range columns {
+		if f, ok := s.Field(column); ok {
+			v.FieldByIndex(f.Index).Set(p.FieldByIndex(f.Index))
+		}
+	}
+	return rec
+}
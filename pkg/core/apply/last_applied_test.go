@@ -0,0 +1,244 @@
+package apply_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/core/apply"
+	"github.com/algebananazzzzz/planear/pkg/core/plan"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Seat struct {
+	ID   string `csv:"id" json:"id"`
+	Team string `csv:"team" json:"team"`
+	Desk string `csv:"desk" json:"desk"`
+}
+
+func TestRun_WritesLastAppliedSnapshot(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	snapshotPath := testutils.WriteJSONFile(t, dir, "last_applied.json", map[string]Seat{
+		"keep":   {ID: "keep", Team: "eng", Desk: "1"},
+		"moved":  {ID: "moved", Team: "eng", Desk: "2"},
+		"gone":   {ID: "gone", Team: "eng", Desk: "3"},
+		"broken": {ID: "broken", Team: "eng", Desk: "4"},
+	})
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", types.Plan[Seat]{
+		Additions: []types.RecordAddition[Seat]{{Key: "new", New: Seat{ID: "new", Team: "ops", Desk: "5"}}},
+		Updates: []types.RecordUpdate[Seat]{
+			{
+				Key:     "moved",
+				Old:     Seat{ID: "moved", Team: "sales", Desk: "2"},
+				New:     Seat{ID: "moved", Team: "sales", Desk: "9"},
+				Changes: []types.FieldChange{{Field: "desk", OldValue: "2", NewValue: "9"}},
+			},
+			{
+				Key:     "broken",
+				Old:     Seat{ID: "broken", Team: "eng", Desk: "4"},
+				New:     Seat{ID: "broken", Team: "eng", Desk: "8"},
+				Changes: []types.FieldChange{{Field: "desk", OldValue: "4", NewValue: "8"}},
+			},
+		},
+		Deletions: []types.RecordDeletion[Seat]{{Key: "gone", Old: Seat{ID: "gone", Team: "eng", Desk: "3"}}},
+		Conflicts: []types.RecordConflict{{
+			Key:    "moved",
+			Fields: []types.FieldConflict{{Field: "team", Base: "eng", Local: "ops", Remote: "sales"}},
+		}},
+	})
+
+	err := apply.Run(apply.RunParams[Seat]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(s Seat) string { return s.ID },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(types.RecordAddition[Seat]) error { return nil },
+		OnUpdate: func(u types.RecordUpdate[Seat]) error {
+			if u.Key == "broken" {
+				return errors.New("boom")
+			}
+			return nil
+		},
+		OnDelete:        func(types.RecordDeletion[Seat]) error { return nil },
+		LastAppliedPath: snapshotPath,
+	})
+	assert.ErrorContains(t, err, "plan execution incomplete")
+
+	var snapshot map[string]Seat
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, snapshotPath), &snapshot))
+	assert.Equal(t, map[string]Seat{
+		"keep":   {ID: "keep", Team: "eng", Desk: "1"},
+		"moved":  {ID: "moved", Team: "eng", Desk: "9"}, // the kept-remote conflict keeps its base
+		"broken": {ID: "broken", Team: "eng", Desk: "4"},
+		"new":    {ID: "new", Team: "ops", Desk: "5"},
+	}, snapshot)
+}
+
+func TestRun_CreatesLastAppliedSnapshot(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", types.Plan[Seat]{
+		Additions: []types.RecordAddition[Seat]{{Key: "a", New: Seat{ID: "a", Desk: "1"}}},
+	})
+	snapshotPath := filepath.Join(dir, "state", "last_applied.json")
+
+	err := apply.Run(apply.RunParams[Seat]{
+		PlanFilePath:    planFilePath,
+		FormatRecord:    func(s Seat) string { return s.ID },
+		FormatKey:       func(key string) string { return key },
+		OnAdd:           func(types.RecordAddition[Seat]) error { return nil },
+		OnUpdate:        func(types.RecordUpdate[Seat]) error { return nil },
+		OnDelete:        func(types.RecordDeletion[Seat]) error { return nil },
+		LastAppliedPath: snapshotPath,
+	})
+	require.NoError(t, err)
+
+	var snapshot map[string]Seat
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, snapshotPath), &snapshot))
+	assert.Equal(t, map[string]Seat{"a": {ID: "a", Desk: "1"}}, snapshot)
+}
+
+func TestRun_LastAppliedKeepsOutOfBandChanges(t *testing.T) {
+	csvDir := testutils.NewTestDir(t)
+	dir := testutils.NewTestDir(t)
+	testutils.WriteCSVFile(t, csvDir, "seats.csv", []Seat{{ID: "a", Team: "eng", Desk: "2"}})
+	snapshotPath := testutils.WriteJSONFile(t, dir, "last_applied.json", map[string]Seat{
+		"a": {ID: "a", Team: "eng", Desk: "1"},
+	})
+	planFilePath := filepath.Join(dir, "plan.json")
+
+	// The remote team was changed out of band since the last apply.
+	remote := map[string]Seat{"a": {ID: "a", Team: "sales", Desk: "1"}}
+	generate := func() (*types.Plan[Seat], error) {
+		return plan.Generate(plan.GenerateParams[Seat]{
+			CSVPath:           csvDir,
+			OutputFilePath:    planFilePath,
+			FormatRecordFunc:  func(s Seat) string { return s.ID },
+			FormatKeyFunc:     func(key string) string { return key },
+			ExtractKeyFunc:    func(s Seat) string { return s.ID },
+			LoadRemoteRecords: func() (map[string]Seat, error) { return remote, nil },
+			ValidateRecord:    testutils.NoopValidator[Seat](),
+			LastAppliedPath:   snapshotPath,
+		})
+	}
+
+	first, err := generate()
+	require.NoError(t, err)
+	require.Len(t, first.Updates, 1)
+	assert.Equal(t, []types.FieldChange{{Field: "desk", OldValue: "1", NewValue: "2"}}, first.Updates[0].Changes)
+
+	err = apply.Run(apply.RunParams[Seat]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(s Seat) string { return s.ID },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(types.RecordAddition[Seat]) error { return nil },
+		OnUpdate: func(u types.RecordUpdate[Seat]) error {
+			remote[u.Key] = u.New
+			return nil
+		},
+		OnDelete:        func(types.RecordDeletion[Seat]) error { return nil },
+		LastAppliedPath: snapshotPath,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Seat{ID: "a", Team: "sales", Desk: "2"}, remote["a"])
+
+	second, err := generate()
+	require.NoError(t, err)
+	assert.True(t, second.IsEmpty())
+	assert.Empty(t, second.Conflicts)
+}
+
+func TestRun_LastAppliedRecordsInSyncRecords(t *testing.T) {
+	csvDir := testutils.NewTestDir(t)
+	dir := testutils.NewTestDir(t)
+	testutils.WriteCSVFile(t, csvDir, "seats.csv", []Seat{
+		{ID: "a", Team: "eng", Desk: "1"},
+		{ID: "b", Team: "eng", Desk: "3"},
+	})
+	snapshotPath := filepath.Join(dir, "last_applied.json")
+	planFilePath := filepath.Join(dir, "plan.json")
+
+	// "a" is already in sync; only "b" needs an update.
+	remote := map[string]Seat{
+		"a": {ID: "a", Team: "eng", Desk: "1"},
+		"b": {ID: "b", Team: "eng", Desk: "2"},
+	}
+	generate := func() (*types.Plan[Seat], error) {
+		return plan.Generate(plan.GenerateParams[Seat]{
+			CSVPath:           csvDir,
+			OutputFilePath:    planFilePath,
+			FormatRecordFunc:  func(s Seat) string { return s.ID },
+			FormatKeyFunc:     func(key string) string { return key },
+			ExtractKeyFunc:    func(s Seat) string { return s.ID },
+			LoadRemoteRecords: func() (map[string]Seat, error) { return remote, nil },
+			ValidateRecord:    testutils.NoopValidator[Seat](),
+			LastAppliedPath:   snapshotPath,
+		})
+	}
+	run := func() error {
+		return apply.Run(apply.RunParams[Seat]{
+			PlanFilePath: planFilePath,
+			FormatRecord: func(s Seat) string { return s.ID },
+			FormatKey:    func(key string) string { return key },
+			OnAdd:        func(types.RecordAddition[Seat]) error { return nil },
+			OnUpdate: func(u types.RecordUpdate[Seat]) error {
+				remote[u.Key] = u.New
+				return nil
+			},
+			OnDelete:        func(types.RecordDeletion[Seat]) error { return nil },
+			LastAppliedPath: snapshotPath,
+		})
+	}
+
+	first, err := generate()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Seat{"a": {ID: "a", Team: "eng", Desk: "1"}}, first.InSync)
+	require.NoError(t, run())
+
+	var snapshot map[string]Seat
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, snapshotPath), &snapshot))
+	assert.Equal(t, map[string]Seat{
+		"a": {ID: "a", Team: "eng", Desk: "1"},
+		"b": {ID: "b", Team: "eng", Desk: "3"},
+	}, snapshot)
+
+	// "a" is edited out of band while the CSV moves it to another desk.
+	remote["a"] = Seat{ID: "a", Team: "sales", Desk: "5"}
+	testutils.WriteCSVFile(t, csvDir, "seats.csv", []Seat{
+		{ID: "a", Team: "eng", Desk: "4"},
+		{ID: "b", Team: "eng", Desk: "3"},
+	})
+	second, err := generate()
+	require.NoError(t, err)
+	assert.Empty(t, second.Updates, "the out-of-band team is kept and the desk conflict keeps the remote value")
+	assert.Equal(t, []types.RecordConflict{{
+		Key:    "a",
+		Fields: []types.FieldConflict{{Field: "desk", Base: "1", Local: "4", Remote: "5"}},
+	}}, second.Conflicts)
+}
+
+func TestRun_LastAppliedSkipsInSyncRecordsAfterFailures(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	snapshotPath := filepath.Join(dir, "last_applied.json")
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", types.Plan[Seat]{
+		Additions: []types.RecordAddition[Seat]{{Key: "new", New: Seat{ID: "new"}}},
+		InSync:    map[string]Seat{"a": {ID: "a", Desk: "1"}},
+	})
+
+	err := apply.Run(apply.RunParams[Seat]{
+		PlanFilePath:    planFilePath,
+		FormatRecord:    func(s Seat) string { return s.ID },
+		FormatKey:       func(key string) string { return key },
+		OnAdd:           func(types.RecordAddition[Seat]) error { return errors.New("boom") },
+		OnUpdate:        func(types.RecordUpdate[Seat]) error { return nil },
+		OnDelete:        func(types.RecordDeletion[Seat]) error { return nil },
+		LastAppliedPath: snapshotPath,
+	})
+	assert.ErrorContains(t, err, "plan execution incomplete")
+
+	var snapshot map[string]Seat
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, snapshotPath), &snapshot))
+	assert.Empty(t, snapshot)
+}
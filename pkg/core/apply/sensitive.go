@@ -0,0 +1,129 @@
+package apply
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// restoringCallbacks wraps onAdd and onUpdate so they receive records whose
+// sensitive columns hold the values reloaded from the local records rather
+// than the redacted ones stored in the plan file; columns the CSV left
+// unset (plan.Unset) are reloaded from the remote records instead. Every
+// reloaded value is checked against its digest in plan.Digests up front, so
+// a CSV or remote record edited since the plan was generated fails the run
+// before any callback fires, as does a digestKey other than the one the
+// plan was generated with. The plan, and therefore the execution report,
+// keeps the redacted values.
+func restoringCallbacks[T any](
+	plan types.Plan[T],
+	loadLocal func() (map[string]T, error),
+	loadRemote func() (map[string]T, error),
+	digestKey []byte,
+	onAdd func(types.RecordAddition[T]) error,
+	onUpdate func(types.RecordUpdate[T]) error,
+) (func(types.RecordAddition[T]) error, func(types.RecordUpdate[T]) error, error) {
+	if loadLocal == nil {
+		return nil, nil, fmt.Errorf("plan contains sensitive values; RunParams.LoadLocalRecords is required")
+	}
+	if loadRemote == nil && len(plan.Unset) > 0 {
+		return nil, nil, fmt.Errorf("plan contains unset sensitive values; RunParams.LoadRemoteRecords is required")
+	}
+	s, err := schema.Of[T]()
+	if err != nil {
+		return nil, nil, err
+	}
+	digester, err := schema.NewDigester(plan.DigestSalt, digestKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	local, err := loadLocal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load local records: %w", err)
+	}
+	var remote map[string]T
+	if len(plan.Unset) > 0 {
+		if remote, err = loadRemote(); err != nil {
+			return nil, nil, fmt.Errorf("failed to load remote records: %w", err)
+		}
+	}
+
+	// source returns the record the sensitive column of key is reloaded
+	// from. Records are looked up by their original key when the plan was
+	// generated with a KeyNormalizer.
+	source := func(key, column, localKey, remoteKey string) (reflect.Value, error) {
+		if slices.Contains(plan.Unset[key], column) {
+			src, ok := remote[remoteKey]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("key %q is no longer in the remote records", remoteKey)
+			}
+			return reflect.ValueOf(src), nil
+		}
+		src, ok := local[localKey]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("key %q is no longer in the local records", localKey)
+		}
+		return reflect.ValueOf(src), nil
+	}
+
+	// Check every planned key up front; the callbacks then only copy values.
+	check := func(key, localKey, remoteKey string) error {
+		for column, digest := range plan.Digests[key] {
+			f, ok := s.Field(column)
+			if !ok {
+				return fmt.Errorf("key %q: unknown sensitive column %q", key, column)
+			}
+			srcV, err := source(key, column, localKey, remoteKey)
+			if err != nil {
+				return err
+			}
+			if digester.Digest(srcV.FieldByIndex(f.Index).Interface()) != digest {
+				return fmt.Errorf("key %q: sensitive column %q changed since the plan was generated", key, column)
+			}
+		}
+		return nil
+	}
+	for _, a := range plan.Additions {
+		if err := check(a.Key, originalKey(a.Key, a.LocalKey), ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, u := range plan.Updates {
+		if err := check(u.Key, originalKey(u.Key, u.LocalKey), originalKey(u.Key, u.RemoteKey)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// restore copies only the sensitive columns, so values set by other
+	// wrappers (see resolvingCallbacks) are kept.
+	restore := func(key, localKey, remoteKey string, rec T) T {
+		dstV := reflect.ValueOf(&rec).Elem()
+		for column := range plan.Digests[key] {
+			f, _ := s.Field(column)
+			srcV, _ := source(key, column, localKey, remoteKey)
+			dstV.FieldByIndex(f.Index).Set(srcV.FieldByIndex(f.Index))
+		}
+		return rec
+	}
+
+	wrappedAdd := func(a types.RecordAddition[T]) error {
+		a.New = restore(a.Key, originalKey(a.Key, a.LocalKey), "", a.New)
+		return onAdd(a)
+	}
+	wrappedUpdate := func(u types.RecordUpdate[T]) error {
+		u.New = restore(u.Key, originalKey(u.Key, u.LocalKey), originalKey(u.Key, u.RemoteKey), u.New)
+		return onUpdate(u)
+	}
+	return wrappedAdd, wrappedUpdate, nil
+}
+
+// originalKey returns the key a plan entry had before key normalization.
+func originalKey(key, original string) string {
+	if original != "" {
+		return original
+	}
+	return key
+}
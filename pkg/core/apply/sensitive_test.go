@@ -0,0 +1,245 @@
+package apply_test
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/core/apply"
+	"github.com/algebananazzzzz/planear/pkg/core/plan"
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Login struct {
+	ID       string `csv:"id" json:"id"`
+	Password string `csv:"password,sensitive" json:"password"`
+}
+
+// loginSalt keys the digests of the hand-written plans below.
+var loginSalt = strings.Repeat("5a", 32)
+
+func loginDigest(v any) string {
+	d, _ := schema.NewDigester(loginSalt, nil)
+	return d.Digest(v)
+}
+
+func digestPlan() types.Plan[Login] {
+	return types.Plan[Login]{
+		Additions: []types.RecordAddition[Login]{{Key: "1", New: Login{ID: "1", Password: "(sensitive)"}}},
+		Updates: []types.RecordUpdate[Login]{{
+			Key: "2",
+			Old: Login{ID: "2", Password: "(sensitive)"},
+			New: Login{ID: "2", Password: "(sensitive)"},
+			Changes: []types.FieldChange{
+				{Field: "password", OldValue: loginDigest("old"), NewValue: loginDigest("two")},
+			},
+		}},
+		SensitiveColumns: []string{"password"},
+		DigestSalt:       loginSalt,
+		Digests: map[string]map[string]string{
+			"1": {"password": loginDigest("one")},
+			"2": {"password": loginDigest("two")},
+		},
+	}
+}
+
+func runLogins(t *testing.T, local map[string]Login, loadLocal bool) (map[string]string, error) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", digestPlan())
+
+	var mu sync.Mutex
+	passwords := map[string]string{}
+	record := func(l Login) error {
+		mu.Lock()
+		passwords[l.ID] = l.Password
+		mu.Unlock()
+		return nil
+	}
+
+	params := apply.RunParams[Login]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(l Login) string { return l.ID + ":" + l.Password },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(a types.RecordAddition[Login]) error { return record(a.New) },
+		OnUpdate:     func(u types.RecordUpdate[Login]) error { return record(u.New) },
+		OnDelete:     func(types.RecordDeletion[Login]) error { return nil },
+	}
+	if loadLocal {
+		params.LoadLocalRecords = func() (map[string]Login, error) { return local, nil }
+	}
+	err := apply.Run(params)
+	return passwords, err
+}
+
+func TestRun_RestoresSensitiveValuesFromLocalRecords(t *testing.T) {
+	passwords, err := runLogins(t, map[string]Login{
+		"1": {ID: "1", Password: "one"},
+		"2": {ID: "2", Password: "two"},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"1": "one", "2": "two"}, passwords)
+}
+
+func TestRun_SensitiveValueChangedSincePlan(t *testing.T) {
+	passwords, err := runLogins(t, map[string]Login{
+		"1": {ID: "1", Password: "one"},
+		"2": {ID: "2", Password: "edited"},
+	}, true)
+	assert.ErrorContains(t, err, `key "2": sensitive column "password" changed since the plan was generated`)
+	assert.Empty(t, passwords)
+}
+
+func TestRun_SensitiveDigestsRequireTheirKey(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", digestPlan())
+
+	err := apply.Run(apply.RunParams[Login]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(l Login) string { return l.ID },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(types.RecordAddition[Login]) error { return nil },
+		OnUpdate:     func(types.RecordUpdate[Login]) error { return nil },
+		OnDelete:     func(types.RecordDeletion[Login]) error { return nil },
+		LoadLocalRecords: func() (map[string]Login, error) {
+			return map[string]Login{"1": {ID: "1", Password: "one"}, "2": {ID: "2", Password: "two"}}, nil
+		},
+		DigestKey: []byte("not-the-key"),
+	})
+	assert.ErrorContains(t, err, "changed since the plan was generated")
+}
+
+func TestRun_SensitiveKeyMissingFromLocalRecords(t *testing.T) {
+	_, err := runLogins(t, map[string]Login{"2": {ID: "2", Password: "two"}}, true)
+	assert.ErrorContains(t, err, `key "1" is no longer in the local records`)
+}
+
+func TestRun_SensitivePlanRequiresLoadLocalRecords(t *testing.T) {
+	_, err := runLogins(t, nil, false)
+	assert.ErrorContains(t, err, "RunParams.LoadLocalRecords is required")
+}
+
+func TestRun_RestoresSensitiveValuesByOriginalLocalKey(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	planFilePath := testutils.WriteJSONFile(t, dir, "plan.json", types.Plan[Login]{
+		Additions: []types.RecordAddition[Login]{{
+			Key:      "ada",
+			LocalKey: "Ada",
+			New:      Login{ID: "Ada", Password: "(sensitive)"},
+		}},
+		SensitiveColumns: []string{"password"},
+		DigestSalt:       loginSalt,
+		Digests:          map[string]map[string]string{"ada": {"password": loginDigest("pw")}},
+	})
+
+	var got types.RecordAddition[Login]
+	err := apply.Run(apply.RunParams[Login]{
+		PlanFilePath: planFilePath,
+		FormatRecord: func(l Login) string { return l.ID },
+		FormatKey:    func(key string) string { return key },
+		OnAdd:        func(a types.RecordAddition[Login]) error { got = a; return nil },
+		OnUpdate:     func(types.RecordUpdate[Login]) error { return nil },
+		OnDelete:     func(types.RecordDeletion[Login]) error { return nil },
+		LoadLocalRecords: func() (map[string]Login, error) {
+			return map[string]Login{"Ada": {ID: "Ada", Password: "pw"}}, nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", got.LocalKey)
+	assert.Equal(t, "pw", got.New.Password)
+}
+
+func TestRun_NormalizedSensitiveColumnsMatchTheirDigests(t *testing.T) {
+	csvDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, csvDir, "logins.csv", []byte("id,password\n1,New-Pass\n"))
+	planFilePath := filepath.Join(testutils.NewTestDir(t), "plan.json")
+	loadLocal := func() (map[string]Login, error) {
+		return input.LoadCSVDirectoryToMap(csvDir, func(l Login) string { return l.ID })
+	}
+
+	_, err := plan.Generate(plan.GenerateParams[Login]{
+		CSVPath:           csvDir,
+		OutputFilePath:    planFilePath,
+		FormatRecordFunc:  func(l Login) string { return l.ID },
+		FormatKeyFunc:     func(key string) string { return key },
+		ExtractKeyFunc:    func(l Login) string { return l.ID },
+		LoadRemoteRecords: func() (map[string]Login, error) { return map[string]Login{"1": {ID: "1", Password: "old"}}, nil },
+		ValidateRecord:    testutils.NoopValidator[Login](),
+		Normalize: func(l Login) Login {
+			l.Password = strings.ToLower(l.Password)
+			return l
+		},
+	})
+	require.NoError(t, err)
+
+	var got types.RecordUpdate[Login]
+	err = apply.Run(apply.RunParams[Login]{
+		PlanFilePath:     planFilePath,
+		FormatRecord:     func(l Login) string { return l.ID },
+		FormatKey:        func(key string) string { return key },
+		OnAdd:            func(types.RecordAddition[Login]) error { return nil },
+		OnUpdate:         func(u types.RecordUpdate[Login]) error { got = u; return nil },
+		OnDelete:         func(types.RecordDeletion[Login]) error { return nil },
+		LoadLocalRecords: loadLocal,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "New-Pass", got.New.Password)
+}
+
+func TestRun_UnsetSensitiveColumnsComeFromRemote(t *testing.T) {
+	type Profile struct {
+		ID    string `csv:"id" json:"id"`
+		Name  string `csv:"name" json:"name"`
+		Token string `csv:"token,sensitive" json:"token"`
+	}
+	csvDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, csvDir, "profiles.csv", []byte("id,name\n1,Ada\n"))
+	planFilePath := filepath.Join(testutils.NewTestDir(t), "plan.json")
+	remote := map[string]Profile{"1": {ID: "1", Name: "Old", Token: "tok-123"}}
+	loadLocal := func() (map[string]Profile, error) {
+		opts := input.LoadOptions{}
+		opts.IgnoreUnset = true
+		return input.LoadCSVDirectoryToMapWithOptions(csvDir, func(p Profile) string { return p.ID }, opts)
+	}
+	loadRemote := func() (map[string]Profile, error) { return remote, nil }
+
+	result, err := plan.Generate(plan.GenerateParams[Profile]{
+		CSVPath:           csvDir,
+		OutputFilePath:    planFilePath,
+		FormatRecordFunc:  func(p Profile) string { return p.ID },
+		FormatKeyFunc:     func(key string) string { return key },
+		ExtractKeyFunc:    func(p Profile) string { return p.ID },
+		LoadRemoteRecords: loadRemote,
+		ValidateRecord:    testutils.NoopValidator[Profile](),
+		IgnoreUnset:       true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"1": {"token"}}, result.Unset)
+	assert.NotContains(t, string(testutils.ReadFile(t, planFilePath)), "tok-123")
+
+	var got types.RecordUpdate[Profile]
+	run := func(loadRemote func() (map[string]Profile, error)) error {
+		return apply.Run(apply.RunParams[Profile]{
+			PlanFilePath:      planFilePath,
+			FormatRecord:      func(p Profile) string { return p.ID },
+			FormatKey:         func(key string) string { return key },
+			OnAdd:             func(types.RecordAddition[Profile]) error { return nil },
+			OnUpdate:          func(u types.RecordUpdate[Profile]) error { got = u; return nil },
+			OnDelete:          func(types.RecordDeletion[Profile]) error { return nil },
+			LoadLocalRecords:  loadLocal,
+			LoadRemoteRecords: loadRemote,
+		})
+	}
+	assert.ErrorContains(t, run(nil), "RunParams.LoadRemoteRecords is required")
+
+	require.NoError(t, run(loadRemote))
+	assert.Equal(t, Profile{ID: "1", Name: "Ada", Token: "tok-123"}, got.New)
+
+	remote["1"] = Profile{ID: "1", Name: "Old", Token: "rotated"}
+	assert.ErrorContains(t, run(loadRemote), `sensitive column "token" changed since the plan was generated`)
+}
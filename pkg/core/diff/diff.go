@@ -4,13 +4,22 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
 )
 
 // ComputePlanDiff compares local and remote records to generate a reconciliation plan.
 // It identifies which records need to be added, updated, removed, or ignored.
+// Every section of the plan is sorted by key, and the changes of an update
+// follow the struct field order, so equal inputs give equal plans.
 // Validation errors on local records cause them to be ignored with the associated reason.
 //
+// A record present on both sides is an update only if DiffRecords reports a
+// change, i.e. a `csv`-tagged field differs under its comparison options.
+// Untagged fields and remote-only fields tagged `planear:"computed"` are not
+// compared; the latter are copied from the remote record into the update's
+// New record so apply callbacks can use them.
+//
 // Parameters:
 //   - localRecords: map of current local records keyed by string
 //   - remoteRecords: map of existing remote records keyed by string
@@ -23,11 +32,57 @@ func ComputePlanDiff[T any](
 	localRecords, remoteRecords map[string]T,
 	validator func(T) error,
 ) (types.Plan[T], error) {
+	return ComputePlanDiffWithOptions(localRecords, remoteRecords, validator, Options[T]{})
+}
+
+// Options tunes ComputePlanDiffWithOptions.
+type Options[T any] struct {
+	// Normalize, when non-nil, is applied to every local and remote record
+	// before it is validated and compared, e.g. to lowercase emails or trim
+	// whitespace the remote system adds. The plan carries the normalized
+	// records.
+	Normalize func(T) T
+
+	// Unset lists, per local key, columns the local record does not manage
+	// (see input.DecodeOptions.IgnoreUnset). They are taken from the remote
+	// record before validation and comparison, so they never show up as
+	// changes; see FillUnset.
+	Unset map[string][]string
+
+	// Base, when non-nil, holds the last-applied record per key and turns
+	// the comparison into a three-way diff: a field the CSV left as it was
+	// at the last apply keeps its remote value, so changes made by other
+	// systems are not reverted. Fields both sides changed to different
+	// values are listed in Plan.Conflicts and resolved by OnConflict. Keys
+	// missing from Base are diffed two-way.
+	Base       map[string]T
+	OnConflict types.ConflictPolicy
+
+	// Less orders the plan sections by key (see Plan.Sort); nil sorts keys
+	// in string order.
+	Less func(a, b string) bool
+}
+
+// ComputePlanDiffWithOptions is ComputePlanDiff with Options. A local record
+// that differs from its remote counterpart only in ways its field comparers
+// consider equal (see the fold, trim, tolerance and nilempty tag options of
+// package schema) is not an update.
+func ComputePlanDiffWithOptions[T any](
+	localRecords, remoteRecords map[string]T,
+	validator func(T) error,
+	opts Options[T],
+) (types.Plan[T], error) {
+	localRecords, remoteRecords, opts, err := Prepare(localRecords, remoteRecords, opts)
+	if err != nil {
+		return types.Plan[T]{}, err
+	}
+
 	var (
 		additions []types.RecordAddition[T]
 		updates   []types.RecordUpdate[T]
 		deletions []types.RecordDeletion[T]
 		ignores   []types.RecordIgnored[T]
+		conflicts []types.RecordConflict
 	)
 
 	processedKeys := make(map[string]bool)
@@ -47,18 +102,23 @@ func ComputePlanDiff[T any](
 
 		remoteRecord, exists := remoteRecords[key]
 		if exists {
-			// Compare local vs remote; if different, compute field-level changes
-			if !reflect.DeepEqual(localRecord, remoteRecord) {
-				changes, err := DiffRecords(remoteRecord, localRecord)
-				if err != nil {
-					return types.Plan[T]{}, fmt.Errorf("error generating update diff for key %q: %w", key, err)
+			csvRecord := localRecord
+			if base, ok := opts.Base[key]; ok {
+				var fields []types.FieldConflict
+				localRecord, fields = mergeThreeWay(base, localRecord, remoteRecord, opts.OnConflict)
+				if len(fields) > 0 {
+					conflicts = append(conflicts, types.RecordConflict{Key: key, Fields: fields, Policy: opts.OnConflict})
+				}
+			}
+			update, err := planUpdate(key, localRecord, remoteRecord)
+			if err != nil {
+				return types.Plan[T]{}, err
+			}
+			if update != nil {
+				if !reflect.DeepEqual(localRecord, csvRecord) {
+					update.Local = &csvRecord
 				}
-				updates = append(updates, types.RecordUpdate[T]{
-					Key:     key,
-					Changes: changes,
-					Old:     remoteRecord,
-					New:     localRecord,
-				})
+				updates = append(updates, *update)
 			}
 		} else {
 			// Key not present remotely, so add as new record
@@ -79,10 +139,119 @@ func ComputePlanDiff[T any](
 		}
 	}
 
-	return types.Plan[T]{
+	plan := types.Plan[T]{
 		Additions: additions,
 		Updates:   updates,
 		Deletions: deletions,
 		Ignores:   ignores,
+		Conflicts: conflicts,
+	}
+	plan.Sort(opts.Less)
+	return plan, nil
+}
+
+// Prepare returns the records ComputePlanDiffWithOptions compares: the local
+// records with their opts.Unset columns filled from the remote ones (see
+// FillUnset), and the local, remote and opts.Base records normalized by
+// opts.Normalize. The returned Options have neither Unset nor Normalize
+// set, so the prepared records can be passed on to
+// ComputePlanDiffWithOptions with them and are not prepared again.
+func Prepare[T any](localRecords, remoteRecords map[string]T, opts Options[T]) (map[string]T, map[string]T, Options[T], error) {
+	if len(opts.Unset) > 0 {
+		var err error
+		if localRecords, err = FillUnset(localRecords, remoteRecords, opts.Unset); err != nil {
+			return nil, nil, opts, err
+		}
+		opts.Unset = nil
+	}
+	if opts.Normalize != nil {
+		localRecords = normalizeAll(localRecords, opts.Normalize)
+		remoteRecords = normalizeAll(remoteRecords, opts.Normalize)
+		if opts.Base != nil {
+			opts.Base = normalizeAll(opts.Base, opts.Normalize)
+		}
+		opts.Normalize = nil
+	}
+	return localRecords, remoteRecords, opts, nil
+}
+
+// FillUnset returns a copy of localRecords in which the unset columns of each
+// key are copied from its remote record, so that planear can co-own records
+// with other systems without clobbering fields it does not manage. Keys
+// without a remote record keep their local values, i.e. the column's
+// default or zero value. A column T does not map is an error.
+func FillUnset[T any](localRecords, remoteRecords map[string]T, unset map[string][]string) (map[string]T, error) {
+	s, err := schema.For(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]T, len(localRecords))
+	for key, local := range localRecords {
+		out[key] = local
+		remote, ok := remoteRecords[key]
+		if !ok || len(unset[key]) == 0 {
+			continue
+		}
+		l := reflect.ValueOf(&local).Elem()
+		r := reflect.ValueOf(remote)
+		for _, column := range unset[key] {
+			f, ok := s.Field(column)
+			if !ok {
+				return nil, fmt.Errorf("unset column %q of key %q is not a column of %s", column, key, s.Type)
+			}
+			l.FieldByIndex(f.Index).Set(r.FieldByIndex(f.Index))
+		}
+		out[key] = local
+	}
+	return out, nil
+}
+
+// planUpdate returns the update turning remote into local, or nil when
+// their managed fields are equal.
+func planUpdate[T any](key string, local, remote T) (*types.RecordUpdate[T], error) {
+	// reflect.DeepEqual is a fast path: equal records never have changes.
+	if reflect.DeepEqual(local, remote) {
+		return nil, nil
+	}
+	changes, err := DiffRecords(remote, local)
+	if err != nil {
+		return nil, fmt.Errorf("error generating update diff for key %q: %w", key, err)
+	}
+	if len(changes) == 0 {
+		// Only untagged or computed fields differ, or differences the
+		// field comparers ignore.
+		return nil, nil
+	}
+	return &types.RecordUpdate[T]{
+		Key:     key,
+		Changes: changes,
+		Old:     remote,
+		New:     withComputed(local, remote),
 	}, nil
 }
+
+func normalizeAll[T any](records map[string]T, normalize func(T) T) map[string]T {
+	out := make(map[string]T, len(records))
+	for key, rec := range records {
+		out[key] = normalize(rec)
+	}
+	return out
+}
+
+// withComputed returns local with the `planear:"computed"` fields of its
+// type copied from remote.
+func withComputed[T any](local, remote T) T {
+	v := reflect.ValueOf(&local).Elem()
+	if v.Kind() != reflect.Struct {
+		return local
+	}
+	s, err := schema.For(v.Type())
+	if err != nil || len(s.Computed) == 0 {
+		return local
+	}
+	r := reflect.ValueOf(remote)
+	for _, f := range s.Computed {
+		v.FieldByIndex(f.Index).Set(r.FieldByIndex(f.Index))
+	}
+	return local
+}
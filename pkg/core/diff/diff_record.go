@@ -3,13 +3,22 @@ package diff
 import (
 	"fmt"
 	"reflect"
-	"strings"
 
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
 )
 
 // DiffRecords compares two records of the same struct type and returns a list of changed fields.
 // Fields must be exported and tagged with `csv:"<name>"` to be considered.
+//
+// Composite fields are compared element by element:
+//   - slices report one change per differing index, named "<field>[<index>]"
+//   - maps report one change per differing key, named "<field>[<key>]"
+//   - structs tagged `inline` are flattened, with the tag name used as a prefix
+//
+// A missing slice element or map entry is reported as a nil OldValue or NewValue.
+// The field layout comes from the cached schema of the record type, so the tags
+// are only parsed once per type.
 func DiffRecords[T any](oldVal, newVal T) ([]types.FieldChange, error) {
 	oldV := reflect.ValueOf(oldVal)
 	newV := reflect.ValueOf(newVal)
@@ -18,34 +27,15 @@ func DiffRecords[T any](oldVal, newVal T) ([]types.FieldChange, error) {
 		return nil, fmt.Errorf("type mismatch: %T vs %T", oldVal, newVal)
 	}
 
-	var changes []types.FieldChange
-	t := oldV.Type()
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		if !field.IsExported() {
-			continue
-		}
-
-		csvTag := field.Tag.Get("csv")
-		fieldName := strings.Split(csvTag, ",")[0]
-		if fieldName == "" || fieldName == "-" {
-			continue
-		}
-
-		oldField := oldV.Field(i)
-		newField := newV.Field(i)
-
-		// Use DeepEqual to account for pointer values and nested structs
-		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
-			changes = append(changes, types.FieldChange{
-				Field:    fieldName,
-				OldValue: oldField.Interface(),
-				NewValue: newField.Interface(),
-			})
-		}
+	s, err := schema.For(oldV.Type())
+	if err != nil {
+		return nil, err
 	}
 
+	var changes []types.FieldChange
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		changes = append(changes, f.Compare(oldV.FieldByIndex(f.Index), newV.FieldByIndex(f.Index))...)
+	}
 	return changes, nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/algebananazzzzz/planear/pkg/core/diff"
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
 	"github.com/stretchr/testify/require"
 )
@@ -114,3 +115,64 @@ func TestDiffRecords_PointerField_NilChanges(t *testing.T) {
 		{Field: "email", OldValue: &email, NewValue: nilStringPtr},
 	}, changes2)
 }
+
+func TestDiffRecords_CompositeFields(t *testing.T) {
+	type Address struct {
+		City string `csv:"city"`
+		Zip  string `csv:"zip"`
+	}
+	type Composite struct {
+		Roles  []string          `csv:"roles,split=|"`
+		Labels map[string]string `csv:"labels,kv=;="`
+		Addr   Address           `csv:"addr_,inline"`
+	}
+
+	old := Composite{
+		Roles:  []string{"admin", "dev"},
+		Labels: map[string]string{"env": "prod", "tier": "web"},
+		Addr:   Address{City: "Paris", Zip: "75001"},
+	}
+	new := Composite{
+		Roles:  []string{"admin", "ops", "sre"},
+		Labels: map[string]string{"env": "staging", "team": "core"},
+		Addr:   Address{City: "Lyon", Zip: "75001"},
+	}
+
+	changes, err := diff.DiffRecords(old, new)
+	require.NoError(t, err)
+	require.Equal(t, []types.FieldChange{
+		{Field: "roles[1]", OldValue: "dev", NewValue: "ops"},
+		{Field: "roles[2]", OldValue: nil, NewValue: "sre"},
+		{Field: "labels[env]", OldValue: "prod", NewValue: "staging"},
+		{Field: "labels[team]", OldValue: nil, NewValue: "core"},
+		{Field: "labels[tier]", OldValue: "web", NewValue: nil},
+		{Field: "addr_city", OldValue: "Paris", NewValue: "Lyon"},
+	}, changes)
+}
+
+func TestDiffRecords_NilAndEmptyCompositesEqual(t *testing.T) {
+	type Composite struct {
+		Roles  []string          `csv:"roles,split=|"`
+		Labels map[string]string `csv:"labels,kv=;="`
+	}
+
+	changes, err := diff.DiffRecords(
+		Composite{},
+		Composite{Roles: []string{}, Labels: map[string]string{}},
+	)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+}
+
+func TestDiffRecords_SensitiveFieldsReportDigests(t *testing.T) {
+	type Account struct {
+		ID       int    `csv:"id"`
+		Password string `csv:"password,sensitive"`
+	}
+
+	changes, err := diff.DiffRecords(Account{ID: 1, Password: "hunter2"}, Account{ID: 1, Password: "correct horse"})
+	require.NoError(t, err)
+	require.Equal(t, []types.FieldChange{
+		{Field: "password", OldValue: schema.Digest("hunter2"), NewValue: schema.Digest("correct horse")},
+	}, changes)
+}
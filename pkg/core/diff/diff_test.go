@@ -2,11 +2,14 @@ package diff_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/algebananazzzzz/planear/pkg/core/diff"
+	"github.com/algebananazzzzz/planear/pkg/formatters"
+	"github.com/algebananazzzzz/planear/pkg/types"
 )
 
 // Simple test struct with csv tags for diffing
@@ -88,3 +91,181 @@ func TestComputePlanDiff(t *testing.T) {
 type Record struct {
 	ID string `csv:"id"`
 }
+
+type Product struct {
+	SKU   string  `csv:"sku"`
+	Email string  `csv:"email,fold,trim"`
+	Price float64 `csv:"price,tolerance=0.01"`
+	Note  *string `csv:"note,nilempty"`
+}
+
+func TestComputePlanDiff_FieldComparersSkipSpuriousUpdates(t *testing.T) {
+	empty := ""
+	local := map[string]Product{
+		"1": {SKU: "1", Email: "Ops@Example.com", Price: 9.99, Note: nil},
+		"2": {SKU: "2", Email: "a@example.com", Price: 10.50},
+	}
+	remote := map[string]Product{
+		"1": {SKU: "1", Email: " ops@example.com ", Price: 9.989999, Note: &empty},
+		"2": {SKU: "2", Email: "a@example.com", Price: 10.00},
+	}
+
+	plan, err := diff.ComputePlanDiff(local, remote, func(Product) error { return nil })
+	require.NoError(t, err)
+	require.Len(t, plan.Updates, 1)
+	require.Equal(t, "2", plan.Updates[0].Key)
+	require.Equal(t, []types.FieldChange{{Field: "price", OldValue: 10.00, NewValue: 10.50}}, plan.Updates[0].Changes)
+}
+
+func TestComputePlanDiffWithOptions_Normalize(t *testing.T) {
+	local := map[string]TestRecord{
+		"1": {ID: "1", Name: "Alice  "},
+		"2": {ID: "2", Name: "bad"},
+	}
+	remote := map[string]TestRecord{
+		"1": {ID: "1", Name: "alice"},
+		"3": {ID: "3", Name: "  Gone"},
+	}
+
+	var validated []string
+	plan, err := diff.ComputePlanDiffWithOptions(local, remote, func(r TestRecord) error {
+		validated = append(validated, r.Name)
+		return validatorWithError(r)
+	}, diff.Options[TestRecord]{
+		Normalize: func(r TestRecord) TestRecord {
+			r.Name = strings.ToLower(strings.TrimSpace(r.Name))
+			return r
+		},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"alice", "bad"}, validated, "records are normalized before validation")
+	require.Empty(t, plan.Updates)
+	require.Empty(t, plan.Additions)
+	require.Len(t, plan.Ignores, 1)
+	require.Len(t, plan.Deletions, 1)
+	require.Equal(t, "gone", plan.Deletions[0].Old.Name, "the plan carries normalized records")
+}
+
+type Row struct {
+	Key       string `csv:"key"`
+	Value     string `csv:"value"`
+	RemoteID  int64  `csv:"-" planear:"computed"`
+	UpdatedAt string // untagged: not managed
+}
+
+func TestComputePlanDiff_RemoteOnlyFieldsDoNotCauseUpdates(t *testing.T) {
+	local := map[string]Row{"1": {Key: "1", Value: "same"}}
+	remote := map[string]Row{"1": {Key: "1", Value: "same", RemoteID: 42, UpdatedAt: "2024-01-01"}}
+
+	plan, err := diff.ComputePlanDiff(local, remote, func(Row) error { return nil })
+	require.NoError(t, err)
+	require.True(t, plan.IsEmpty())
+}
+
+func TestComputePlanDiff_CarriesComputedFieldsIntoUpdates(t *testing.T) {
+	local := map[string]Row{"1": {Key: "1", Value: "new"}}
+	remote := map[string]Row{"1": {Key: "1", Value: "old", RemoteID: 42, UpdatedAt: "2024-01-01"}}
+
+	plan, err := diff.ComputePlanDiff(local, remote, func(Row) error { return nil })
+	require.NoError(t, err)
+	require.Len(t, plan.Updates, 1)
+	require.Equal(t, []types.FieldChange{{Field: "value", OldValue: "old", NewValue: "new"}}, plan.Updates[0].Changes)
+	require.Equal(t, Row{Key: "1", Value: "new", RemoteID: 42}, plan.Updates[0].New)
+	require.Equal(t, int64(0), local["1"].RemoteID, "local records are not modified")
+}
+
+func TestComputePlanDiffWithOptions_UnsetColumnsComeFromRemote(t *testing.T) {
+	local := map[string]Row{
+		"1": {Key: "1"},
+		"2": {Key: "2", Value: "new"},
+		"3": {Key: "3"},
+	}
+	remote := map[string]Row{
+		"1": {Key: "1", Value: "owned elsewhere"},
+		"2": {Key: "2", Value: "old"},
+	}
+
+	plan, err := diff.ComputePlanDiffWithOptions(local, remote, func(Row) error { return nil }, diff.Options[Row]{
+		Unset: map[string][]string{"1": {"value"}, "3": {"value"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.Updates, 1)
+	require.Equal(t, "2", plan.Updates[0].Key)
+	require.Equal(t, []types.RecordAddition[Row]{{Key: "3", New: Row{Key: "3"}}}, plan.Additions)
+	require.Empty(t, local["1"].Value, "local records are not modified")
+
+	_, err = diff.ComputePlanDiffWithOptions(local, remote, func(Row) error { return nil }, diff.Options[Row]{
+		Unset: map[string][]string{"1": {"nope"}},
+	})
+	require.EqualError(t, err, `unset column "nope" of key "1" is not a column of diff_test.Row`)
+}
+
+func TestComputePlanDiffWithOptions_ThreeWay(t *testing.T) {
+	type Member struct {
+		ID   string `csv:"id"`
+		Name string `csv:"name"`
+		Team string `csv:"team"`
+	}
+	base := map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "eng"},
+		"2": {ID: "2", Name: "Bob", Team: "eng"},
+		"3": {ID: "3", Name: "Cy", Team: "eng"},
+	}
+	local := map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "eng"},   // unchanged in the CSV
+		"2": {ID: "2", Name: "Bobby", Team: "eng"}, // renamed in the CSV
+		"3": {ID: "3", Name: "Cy", Team: "ops"},    // moved in the CSV...
+		"4": {ID: "4", Name: "Di", Team: "eng"},    // not in the snapshot
+	}
+	remote := map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "sales"}, // moved out of band
+		"2": {ID: "2", Name: "Bob", Team: "sales"}, // moved out of band
+		"3": {ID: "3", Name: "Cy", Team: "sales"},  // ...and moved out of band
+		"4": {ID: "4", Name: "Di", Team: "sales"},
+	}
+	validate := func(Member) error { return nil }
+
+	plan, err := diff.ComputePlanDiffWithOptions(local, remote, validate, diff.Options[Member]{Base: base})
+	require.NoError(t, err)
+	byKey := map[string]types.RecordUpdate[Member]{}
+	for _, u := range plan.Updates {
+		byKey[u.Key] = u
+	}
+	require.Len(t, byKey, 2)
+	require.Equal(t, []types.FieldChange{{Field: "name", OldValue: "Bob", NewValue: "Bobby"}}, byKey["2"].Changes)
+	require.Equal(t, Member{ID: "2", Name: "Bobby", Team: "sales"}, byKey["2"].New, "the out-of-band change is kept")
+	require.Equal(t, []types.FieldChange{{Field: "team", OldValue: "sales", NewValue: "eng"}}, byKey["4"].Changes, "keys without a snapshot are diffed two-way")
+	require.Equal(t, []types.RecordConflict{{
+		Key:    "3",
+		Fields: []types.FieldConflict{{Field: "team", Base: "eng", Local: "ops", Remote: "sales"}},
+	}}, plan.Conflicts)
+
+	plan, err = diff.ComputePlanDiffWithOptions(local, remote, validate, diff.Options[Member]{
+		Base:       base,
+		OnConflict: types.ConflictLocalWins,
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.Updates, 3)
+	require.Len(t, plan.Conflicts, 1)
+	require.Equal(t, types.ConflictLocalWins, plan.Conflicts[0].Policy)
+}
+
+func TestComputePlanDiffWithOptions_ThreeWayRedactsSensitiveConflicts(t *testing.T) {
+	type Login struct {
+		ID       string `csv:"id"`
+		Password string `csv:"password,sensitive"`
+	}
+	plan, err := diff.ComputePlanDiffWithOptions(
+		map[string]Login{"1": {ID: "1", Password: "local"}},
+		map[string]Login{"1": {ID: "1", Password: "remote"}},
+		func(Login) error { return nil },
+		diff.Options[Login]{Base: map[string]Login{"1": {ID: "1", Password: "base"}}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []types.FieldConflict{{
+		Field:  "password",
+		Base:   formatters.Redacted,
+		Local:  formatters.Redacted,
+		Remote: formatters.Redacted,
+	}}, plan.Conflicts[0].Fields)
+}
@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// Iterator yields records in ascending key order, as compared by Go's string
+// comparison (byte order; e.g. `ORDER BY key COLLATE "C"` in PostgreSQL).
+// Next returns ok == false once the records are exhausted.
+type Iterator[T any] interface {
+	Next() (key string, rec T, ok bool, err error)
+}
+
+// IteratorFunc adapts a function to the Iterator interface, e.g. a wrapper
+// around *sql.Rows or a CSV reader.
+type IteratorFunc[T any] func() (key string, rec T, ok bool, err error)
+
+// Next calls f().
+func (f IteratorFunc[T]) Next() (string, T, bool, error) {
+	return f()
+}
+
+// SliceIterator iterates records, which must already be sorted by key.
+func SliceIterator[T any](records []T, key func(T) string) Iterator[T] {
+	i := 0
+	return IteratorFunc[T](func() (string, T, bool, error) {
+		if i == len(records) {
+			var zero T
+			return "", zero, false, nil
+		}
+		rec := records[i]
+		i++
+		return key(rec), rec, true, nil
+	})
+}
+
+// MapIterator iterates records in key order. It sorts the keys up front, so
+// it suits small inputs and tests rather than streaming.
+func MapIterator[T any](records map[string]T) Iterator[T] {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	i := 0
+	return IteratorFunc[T](func() (string, T, bool, error) {
+		if i == len(keys) {
+			var zero T
+			return "", zero, false, nil
+		}
+		key := keys[i]
+		i++
+		return key, records[key], true, nil
+	})
+}
+
+// Sink receives plan entries as StreamPlanDiff produces them, in key order
+// within each kind.
+type Sink[T any] interface {
+	Add(types.RecordAddition[T]) error
+	Update(types.RecordUpdate[T]) error
+	Delete(types.RecordDeletion[T]) error
+	Ignore(types.RecordIgnored[T]) error
+}
+
+// StreamStats counts the entries StreamPlanDiff sent to its Sink.
+type StreamStats struct {
+	Additions int
+	Updates   int
+	Deletions int
+	Ignores   int
+}
+
+// Total returns the number of entries.
+func (s StreamStats) Total() int {
+	return s.Additions + s.Updates + s.Deletions + s.Ignores
+}
+
+// StreamPlanDiff is ComputePlanDiff for data sets too large to hold in
+// memory: local and remote are merge-joined by key, and every plan entry is
+// passed to sink as soon as it is known. Memory use does not depend on the
+// number of records. Both iterators must be sorted by key without
+// duplicates; otherwise StreamPlanDiff stops with an error. Records are
+// validated and compared as in ComputePlanDiff, and like there, a local
+// record that fails validation protects its remote counterpart from
+// deletion.
+func StreamPlanDiff[T any](local, remote Iterator[T], validator func(T) error, sink Sink[T]) (StreamStats, error) {
+	var stats StreamStats
+	l := sortedIterator[T]{it: local, side: "local"}
+	r := sortedIterator[T]{it: remote, side: "remote"}
+	if err := l.advance(); err != nil {
+		return stats, err
+	}
+	if err := r.advance(); err != nil {
+		return stats, err
+	}
+
+	for l.ok || r.ok {
+		var err error
+		switch {
+		case r.ok && (!l.ok || r.key < l.key):
+			stats.Deletions++
+			err = sink.Delete(types.RecordDeletion[T]{Key: r.key, Old: r.rec})
+			if err == nil {
+				err = r.advance()
+			}
+
+		case l.ok && (!r.ok || l.key < r.key):
+			if verr := validator(l.rec); verr != nil {
+				stats.Ignores++
+				err = sink.Ignore(types.RecordIgnored[T]{Key: l.key, Record: l.rec, Reason: verr.Error()})
+			} else {
+				stats.Additions++
+				err = sink.Add(types.RecordAddition[T]{Key: l.key, New: l.rec})
+			}
+			if err == nil {
+				err = l.advance()
+			}
+
+		default:
+			if verr := validator(l.rec); verr != nil {
+				stats.Ignores++
+				err = sink.Ignore(types.RecordIgnored[T]{Key: l.key, Record: l.rec, Reason: verr.Error()})
+			} else {
+				var update *types.RecordUpdate[T]
+				if update, err = planUpdate(l.key, l.rec, r.rec); err == nil && update != nil {
+					stats.Updates++
+					err = sink.Update(*update)
+				}
+			}
+			if err == nil {
+				err = l.advance()
+			}
+			if err == nil {
+				err = r.advance()
+			}
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// sortedIterator holds the current record of an Iterator and checks that
+// keys strictly increase.
+type sortedIterator[T any] struct {
+	it   Iterator[T]
+	side string
+	key  string
+	rec  T
+	ok   bool
+	seen bool
+}
+
+func (s *sortedIterator[T]) advance() error {
+	key, rec, ok, err := s.it.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read %s records: %w", s.side, err)
+	}
+	if ok && s.seen && key <= s.key {
+		return fmt.Errorf("%s records are not sorted by key: %q follows %q", s.side, key, s.key)
+	}
+	s.key, s.rec, s.ok = key, rec, ok
+	s.seen = s.seen || ok
+	return nil
+}
@@ -0,0 +1,151 @@
+package diff_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/algebananazzzzz/planear/pkg/core/diff"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// collectSink gathers streamed entries into a Plan.
+type collectSink[T any] struct {
+	plan types.Plan[T]
+	fail error
+}
+
+func (s *collectSink[T]) Add(a types.RecordAddition[T]) error {
+	s.plan.Additions = append(s.plan.Additions, a)
+	return s.fail
+}
+
+func (s *collectSink[T]) Update(u types.RecordUpdate[T]) error {
+	s.plan.Updates = append(s.plan.Updates, u)
+	return s.fail
+}
+
+func (s *collectSink[T]) Delete(d types.RecordDeletion[T]) error {
+	s.plan.Deletions = append(s.plan.Deletions, d)
+	return s.fail
+}
+
+func (s *collectSink[T]) Ignore(ig types.RecordIgnored[T]) error {
+	s.plan.Ignores = append(s.plan.Ignores, ig)
+	return s.fail
+}
+
+func TestStreamPlanDiff_MatchesComputePlanDiff(t *testing.T) {
+	count := func(n int) *int { return &n }
+	local := map[string]TestRecord{
+		"a": {ID: "a", Name: "same", Count: count(1)},
+		"b": {ID: "b", Name: "changed", Count: count(2)},
+		"c": {ID: "c", Name: "bad"},
+		"d": {ID: "d", Name: "bad"},
+		"f": {ID: "f", Name: "new"},
+	}
+	remote := map[string]TestRecord{
+		"a": {ID: "a", Name: "same", Count: count(1)},
+		"b": {ID: "b", Name: "original", Count: count(2)},
+		"c": {ID: "c", Name: "kept"},
+		"e": {ID: "e", Name: "gone"},
+		"g": {ID: "g", Name: "gone too"},
+	}
+
+	want, err := diff.ComputePlanDiff(local, remote, validatorWithError)
+	require.NoError(t, err)
+
+	sink := &collectSink[TestRecord]{}
+	stats, err := diff.StreamPlanDiff(diff.MapIterator(local), diff.MapIterator(remote), validatorWithError, sink)
+	require.NoError(t, err)
+	require.Equal(t, want, sink.plan)
+	require.Equal(t, diff.StreamStats{Additions: 1, Updates: 1, Deletions: 2, Ignores: 2}, stats)
+	require.Equal(t, 6, stats.Total())
+}
+
+func TestStreamPlanDiff_RequiresSortedUniqueKeys(t *testing.T) {
+	key := func(r TestRecord) string { return r.ID }
+	sorted := diff.SliceIterator([]TestRecord{{ID: "a"}, {ID: "b"}}, key)
+
+	_, err := diff.StreamPlanDiff(diff.SliceIterator([]TestRecord{{ID: "b"}, {ID: "a"}}, key), sorted, validatorWithError, &collectSink[TestRecord]{})
+	require.EqualError(t, err, `local records are not sorted by key: "a" follows "b"`)
+
+	_, err = diff.StreamPlanDiff(diff.MapIterator(map[string]TestRecord{}), diff.SliceIterator([]TestRecord{{ID: "a"}, {ID: "a"}}, key), validatorWithError, &collectSink[TestRecord]{})
+	require.EqualError(t, err, `remote records are not sorted by key: "a" follows "a"`)
+}
+
+func TestStreamPlanDiff_StopsOnErrors(t *testing.T) {
+	broken := diff.IteratorFunc[TestRecord](func() (string, TestRecord, bool, error) {
+		return "", TestRecord{}, false, errors.New("connection reset")
+	})
+	_, err := diff.StreamPlanDiff(diff.MapIterator(map[string]TestRecord{}), broken, validatorWithError, &collectSink[TestRecord]{})
+	require.EqualError(t, err, "failed to read remote records: connection reset")
+
+	sink := &collectSink[TestRecord]{fail: errors.New("disk full")}
+	local := diff.MapIterator(map[string]TestRecord{"a": {ID: "a"}, "b": {ID: "b"}})
+	_, err = diff.StreamPlanDiff(local, diff.MapIterator(map[string]TestRecord{}), validatorWithError, sink)
+	require.EqualError(t, err, "disk full")
+	require.Len(t, sink.plan.Additions, 1, "nothing is emitted after a sink error")
+}
+
+// countSink discards entries, so benchmarks measure the diff alone.
+type countSink[T any] struct{}
+
+func (countSink[T]) Add(types.RecordAddition[T]) error    { return nil }
+func (countSink[T]) Update(types.RecordUpdate[T]) error   { return nil }
+func (countSink[T]) Delete(types.RecordDeletion[T]) error { return nil }
+func (countSink[T]) Ignore(types.RecordIgnored[T]) error  { return nil }
+
+// generated yields records keyed "%09d" for i in [from, to), generated on
+// demand; every seventh record gets a different name when changed is set.
+func generated(from, to int, changed bool) diff.Iterator[Record] {
+	i := from
+	return diff.IteratorFunc[Record](func() (string, Record, bool, error) {
+		if i == to {
+			return "", Record{}, false, nil
+		}
+		key := fmt.Sprintf("%09d", i)
+		rec := Record{ID: key}
+		if changed && i%7 == 0 {
+			rec.ID = key + "x"
+		}
+		i++
+		return key, rec, true, nil
+	})
+}
+
+const benchRecords = 200_000
+
+func BenchmarkStreamPlanDiff(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		local := generated(0, benchRecords, true)
+		remote := generated(benchRecords/10, benchRecords+benchRecords/10, false)
+		if _, err := diff.StreamPlanDiff(local, remote, func(Record) error { return nil }, countSink[Record]{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkComputePlanDiff(b *testing.B) {
+	b.ReportAllocs()
+	collect := func(it diff.Iterator[Record]) map[string]Record {
+		m := map[string]Record{}
+		for {
+			key, rec, ok, _ := it.Next()
+			if !ok {
+				return m
+			}
+			m[key] = rec
+		}
+	}
+	for n := 0; n < b.N; n++ {
+		local := collect(generated(0, benchRecords, true))
+		remote := collect(generated(benchRecords/10, benchRecords+benchRecords/10, false))
+		if _, err := diff.ComputePlanDiff(local, remote, func(Record) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
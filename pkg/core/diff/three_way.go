@@ -0,0 +1,62 @@
+package diff
+
+import (
+	"reflect"
+
+	"github.com/algebananazzzzz/planear/pkg/formatters"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// mergeThreeWay returns local with every managed field the CSV did not change
+// since base (the last-applied record) taken from remote, so changes made
+// out of band are kept instead of reverted. Fields changed on both sides to
+// different values are conflicts: they are returned and resolved by policy.
+// Fields are compared with their comparers (see schema.Field.Equal).
+func mergeThreeWay[T any](base, local, remote T, policy types.ConflictPolicy) (T, []types.FieldConflict) {
+	l := reflect.ValueOf(&local).Elem()
+	if l.Kind() != reflect.Struct {
+		return local, nil
+	}
+	s, err := schema.For(l.Type())
+	if err != nil {
+		return local, nil
+	}
+	b, r := reflect.ValueOf(base), reflect.ValueOf(remote)
+
+	var conflicts []types.FieldConflict
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		lv, bv, rv := l.FieldByIndex(f.Index), b.FieldByIndex(f.Index), r.FieldByIndex(f.Index)
+		switch {
+		case f.Equal(rv, lv):
+			// In sync.
+		case f.Equal(bv, lv):
+			// Only the remote side changed.
+			lv.Set(rv)
+		case f.Equal(bv, rv):
+			// Only the CSV changed: a regular update.
+		default:
+			conflicts = append(conflicts, types.FieldConflict{
+				Field:  f.Column,
+				Base:   conflictValue(f, bv),
+				Local:  conflictValue(f, lv),
+				Remote: conflictValue(f, rv),
+			})
+			if policy == types.ConflictKeepRemote {
+				lv.Set(rv)
+			}
+		}
+	}
+	return local, conflicts
+}
+
+// conflictValue returns the value of v to report in a FieldConflict.
+// Sensitive fields report formatters.Redacted: a digest would only be
+// comparable within this process.
+func conflictValue(f *schema.Field, v reflect.Value) any {
+	if f.Sensitive {
+		return formatters.Redacted
+	}
+	return v.Interface()
+}
@@ -0,0 +1,83 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// decodeErrorIgnores turns row-level decode errors into RecordIgnored entries,
+// one per bad row, keyed by extractKey applied to the partially decoded row.
+// Rows whose key cannot be recovered are keyed by "<file>:<line>". Returns
+// the file-level errors as an error, since those rows cannot be ignored
+// individually.
+func decodeErrorIgnores[T any](errs input.DecodeErrors, extractKey func(T) string) ([]types.RecordIgnored[T], error) {
+	type rowID struct {
+		file string
+		line int
+	}
+
+	var (
+		fileErrs input.DecodeErrors
+		order    []rowID
+		byRow    = map[rowID][]*input.DecodeError{}
+	)
+	for _, e := range errs {
+		if _, ok := e.Record.(T); !ok {
+			fileErrs = append(fileErrs, e)
+			continue
+		}
+		id := rowID{file: e.File, line: e.Line}
+		if _, seen := byRow[id]; !seen {
+			order = append(order, id)
+		}
+		byRow[id] = append(byRow[id], e)
+	}
+	if len(fileErrs) > 0 {
+		return nil, fileErrs
+	}
+
+	ignores := make([]types.RecordIgnored[T], 0, len(order))
+	for _, id := range order {
+		rowErrs := byRow[id]
+		record := rowErrs[0].Record.(T)
+
+		key := extractKey(record)
+		if key == "" {
+			key = fmt.Sprintf("%s:%d", id.file, id.line)
+		}
+
+		reasons := make([]string, len(rowErrs))
+		for i, e := range rowErrs {
+			reasons[i] = e.Error()
+		}
+		ignores = append(ignores, types.RecordIgnored[T]{
+			Key:    key,
+			Record: record,
+			Reason: strings.Join(reasons, "; "),
+		})
+	}
+	return ignores, nil
+}
+
+// withDecodeIgnores appends rows that failed to decode to plan.Ignores. Like
+// records that fail validation, their keys count as present locally, so the
+// matching remote records are not scheduled for deletion.
+func withDecodeIgnores[T any](plan types.Plan[T], ignores []types.RecordIgnored[T]) types.Plan[T] {
+	ignored := make(map[string]bool, len(ignores))
+	for _, ig := range ignores {
+		ignored[ig.Key] = true
+	}
+
+	var deletions []types.RecordDeletion[T]
+	for _, d := range plan.Deletions {
+		if !ignored[d.Key] {
+			deletions = append(deletions, d)
+		}
+	}
+	plan.Deletions = deletions
+	plan.Ignores = append(plan.Ignores, ignores...)
+	return plan
+}
@@ -0,0 +1,86 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// PreventDestroyError is returned by Generate when the plan deletes records
+// that GenerateParams.PreventDestroy protects. No plan file is written.
+type PreventDestroyError struct {
+	Keys []string // protected keys in sorted order
+}
+
+func (e *PreventDestroyError) Error() string {
+	return fmt.Sprintf("%d protected record(s) would be deleted: %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+// DeletionLimitError is returned by Generate when the plan deletes more
+// records than GenerateParams.MaxDeletions or MaxDeletionsPercent allow,
+// e.g. because a CSV file went missing. No plan file is written.
+type DeletionLimitError struct {
+	Deletions int     // deletions in the plan
+	Remote    int     // remote records loaded
+	Max       int     // GenerateParams.MaxDeletions; 0 if unset
+	MaxPct    float64 // GenerateParams.MaxDeletionsPercent; 0 if unset
+}
+
+func (e *DeletionLimitError) Error() string {
+	var limits []string
+	if e.Max > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d", e.Max))
+	}
+	if e.MaxPct > 0 {
+		limits = append(limits, fmt.Sprintf("at most %g%% of %d remote record(s)", e.MaxPct, e.Remote))
+	}
+	return fmt.Sprintf("%d record(s) would be deleted, %s allowed", e.Deletions, strings.Join(limits, " and "))
+}
+
+// filterDeletions drops the deletions that policy or owns exclude: every
+// deletion under DeletionNever, and remote records owns reports as not
+// managed by planear.
+func filterDeletions[T any](plan types.Plan[T], policy types.DeletionPolicy, owns func(T) bool) types.Plan[T] {
+	if policy == types.DeletionNever {
+		plan.Deletions = nil
+		return plan
+	}
+	if owns == nil {
+		return plan
+	}
+	var deletions []types.RecordDeletion[T]
+	for _, d := range plan.Deletions {
+		if owns(d.Old) {
+			deletions = append(deletions, d)
+		}
+	}
+	plan.Deletions = deletions
+	return plan
+}
+
+// checkDeletions rejects a plan whose deletions hit a protected record or
+// exceed the deletion limits; remote is the number of remote records.
+func checkDeletions[T any](plan types.Plan[T], remote int, preventDestroy func(T) bool, maxDeletions int, maxPercent float64) error {
+	if preventDestroy != nil {
+		var keys []string
+		for _, d := range plan.Deletions {
+			if preventDestroy(d.Old) {
+				keys = append(keys, d.Key)
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			return &PreventDestroyError{Keys: keys}
+		}
+	}
+
+	n := len(plan.Deletions)
+	overMax := maxDeletions > 0 && n > maxDeletions
+	overPct := maxPercent > 0 && float64(n) > float64(remote)*maxPercent/100
+	if overMax || overPct {
+		return &DeletionLimitError{Deletions: n, Remote: remote, Max: maxDeletions, MaxPct: maxPercent}
+	}
+	return nil
+}
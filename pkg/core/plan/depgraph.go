@@ -30,6 +30,37 @@ func ComputeLayers[T any](
 	p types.Plan[T],
 	dependsOn func(T) []string,
 ) ([][]types.LayerOp, error) {
+	g := buildOpGraph(p, dependsOn)
+	layeredIDs, err := dag.BuildLayers(g.nodes, g.edges)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(layeredIDs) == 0 {
+		return nil, nil
+	}
+	result := make([][]types.LayerOp, len(layeredIDs))
+	for i, layer := range layeredIDs {
+		result[i] = make([]types.LayerOp, len(layer))
+		for j, id := range layer {
+			result[i][j] = g.ops[id]
+		}
+	}
+	return result, nil
+}
+
+// opGraph is the dependency graph over the operations of a plan. Node IDs
+// are "<kind>:<key>"; edges[id] lists the nodes that must run before id.
+type opGraph struct {
+	nodes []string
+	ops   map[string]types.LayerOp
+	edges map[string][]string
+}
+
+func opNodeID(kind types.LayerOpKind, key string) string { return string(kind) + ":" + key }
+
+// buildOpGraph derives the edges described on ComputeLayers.
+func buildOpGraph[T any](p types.Plan[T], dependsOn func(T) []string) opGraph {
 	type opNode struct {
 		layerOp types.LayerOp
 		nodeID  string
@@ -38,13 +69,11 @@ func ComputeLayers[T any](
 		oldDeps []string
 	}
 
-	idOf := func(kind types.LayerOpKind, key string) string { return string(kind) + ":" + key }
-
 	ops := make([]opNode, 0, len(p.Additions)+len(p.Updates)+len(p.Deletions))
 	for _, a := range p.Additions {
 		ops = append(ops, opNode{
 			layerOp: types.LayerOp{Kind: types.LayerOpAdd, Key: a.Key},
-			nodeID:  idOf(types.LayerOpAdd, a.Key),
+			nodeID:  opNodeID(types.LayerOpAdd, a.Key),
 			key:     a.Key,
 			newDeps: dependsOn(a.New),
 		})
@@ -52,7 +81,7 @@ func ComputeLayers[T any](
 	for _, u := range p.Updates {
 		ops = append(ops, opNode{
 			layerOp: types.LayerOp{Kind: types.LayerOpUpdate, Key: u.Key},
-			nodeID:  idOf(types.LayerOpUpdate, u.Key),
+			nodeID:  opNodeID(types.LayerOpUpdate, u.Key),
 			key:     u.Key,
 			newDeps: dependsOn(u.New),
 			oldDeps: dependsOn(u.Old),
@@ -61,7 +90,7 @@ func ComputeLayers[T any](
 	for _, d := range p.Deletions {
 		ops = append(ops, opNode{
 			layerOp: types.LayerOp{Kind: types.LayerOpDelete, Key: d.Key},
-			nodeID:  idOf(types.LayerOpDelete, d.Key),
+			nodeID:  opNodeID(types.LayerOpDelete, d.Key),
 			key:     d.Key,
 			oldDeps: dependsOn(d.Old),
 		})
@@ -123,20 +152,5 @@ func ComputeLayers[T any](
 		}
 	}
 
-	layeredIDs, err := dag.BuildLayers(nodes, edges)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(layeredIDs) == 0 {
-		return nil, nil
-	}
-	result := make([][]types.LayerOp, len(layeredIDs))
-	for i, layer := range layeredIDs {
-		result[i] = make([]types.LayerOp, len(layer))
-		for j, id := range layer {
-			result[i][j] = nodeToOp[id]
-		}
-	}
-	return result, nil
+	return opGraph{nodes: nodes, ops: nodeToOp, edges: edges}
 }
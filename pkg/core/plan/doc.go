@@ -11,7 +11,7 @@
 // 1. Load local records from CSV directory
 // 2. Load remote records via user-provided callback
 // 3. Compare records to identify differences
-// 4. Validate local records (skipping invalid ones)
+// 4. Validate local records (skipping invalid ones), then the whole set via ValidateSet
 // 5. Generate plan with field-level change details
 // 6. Output plan as JSON and human-readable format
 //
@@ -90,6 +90,25 @@
 // Records that fail validation are not considered errors—they're added to the
 // Ignores list in the plan with the validation error as reason.
 //
+// CSV cells that fail to decode abort generation at the first bad cell by
+// default. Set GenerateParams.OnDecodeError to DecodeErrorFailAll to report
+// every bad cell in one run, or to DecodeErrorIgnoreRow to move bad rows into
+// Ignores with the decode error as reason.
+//
+// # Deletion Protection
+//
+// Every remote record missing from the CSVs is a deletion, so a deleted or
+// truncated CSV file can wipe the remote system. GenerateParams guards
+// against that:
+//
+//   - DeletionPolicy DeletionNever plans no deletions (additive-only)
+//   - OwnsRecord limits deletions to remote records planear manages
+//   - PreventDestroy fails generation if a matching record would be deleted
+//   - MaxDeletions and MaxDeletionsPercent fail generation above a limit
+//
+// Failing checks print the plan and return a *PreventDestroyError or
+// *DeletionLimitError without writing the plan file.
+//
 // # Dependency-Aware Layering (DependsOn)
 //
 // When GenerateParams.DependsOn is set, Generate builds a dependency DAG over
@@ -117,5 +136,8 @@
 // When DependsOn is nil, Plan.Layers is left nil and apply takes its existing
 // flat dispatch path.
 //
+// GenerateParams.Target restricts the plan to selected keys; with DependsOn
+// set, the operations the targeted ones depend on are pulled in as well.
+//
 // See package github.com/algebananazzzzz/planear/pkg/core/apply to execute plans.
 package plan
@@ -2,12 +2,14 @@ package plan
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/algebananazzzzz/planear/pkg/constants"
 	"github.com/algebananazzzzz/planear/pkg/core/diff"
 	"github.com/algebananazzzzz/planear/pkg/formatters"
 	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
 	"github.com/algebananazzzzz/planear/pkg/utils"
 )
@@ -21,6 +23,32 @@ type GenerateParams[T any] struct {
 	LoadRemoteRecords func() (map[string]T, error) // Function to load remote (DB) records
 	ValidateRecord    func(T) error                // Validator for local records
 
+	// ValidateSet, when non-nil, checks rules spanning records, such as a
+	// unique non-key column, per-group quotas or "exactly one admin". It is
+	// called once with every local record that passed ValidateRecord, keyed
+	// by ExtractKeyFunc, and returns an error for each key it rejects (nil
+	// or absent keys pass). OnSetValidationError decides what happens to
+	// rejected keys; the zero value moves them into Plan.Ignores.
+	ValidateSet          func(map[string]T) map[string]error
+	OnSetValidationError types.SetValidationPolicy
+
+	// IgnorePolicy decides whether ignored records (see Plan.Ignores) fail
+	// generation. The zero value (IgnoreAllow) only reports them;
+	// IgnoreFailIfAny and IgnoreFailAboveThreshold (more than
+	// IgnoreThreshold ignored records) print the plan, then return an
+	// *IgnoredRecordsError listing every ignored key without writing the
+	// plan file.
+	IgnorePolicy    types.IgnorePolicy
+	IgnoreThreshold int
+
+	// Normalize, when non-nil, is applied to every local and remote record
+	// before validation and diffing, e.g. to lowercase emails, so that only
+	// meaningful changes become updates. The plan carries the normalized
+	// records. For per-field rules see the fold, trim, tolerance and
+	// nilempty `csv` tag options. Sensitive columns are digested, and
+	// restored by apply.Run, as read from the CSV.
+	Normalize func(T) T
+
 	// DependsOn, when non-nil, makes Generate build a dependency DAG over the
 	// plan and topologically sort it into layers. Returns the keys (as
 	// produced by ExtractKeyFunc) that this record references. Keys not
@@ -31,6 +59,144 @@ type GenerateParams[T any] struct {
 	// scheduled after every row in the plan that depends on it (by its new
 	// state for adds/updates, or its old state for deletes/updates).
 	DependsOn func(T) []string
+
+	// Target, when non-zero, limits the plan to the targeted records, e.g.
+	// to fix a single broken row without applying the full data set. With
+	// DependsOn set, the operations targeted ones depend on are included
+	// too unless Target.NoDependencies is set. Ignored records outside the
+	// target are dropped.
+	Target Target[T]
+
+	// KeyNormalizer, when non-nil, is applied to the keys of both local and
+	// remote records before they are matched, e.g. strings.ToLower for
+	// emails or norm.NFC.String from golang.org/x/text for Unicode forms,
+	// so the same record is not planned as an add plus a delete. Two local
+	// (or two remote) keys normalizing to the same key fail generation.
+	// Key columns that differ only in ways the normalizer removes are not
+	// updates; an update's New record keeps their remote value. The plan
+	// is keyed by normalized keys, as are the keys returned by DependsOn
+	// and ValidateSet and those listed in Target; the original keys are
+	// kept in the LocalKey and RemoteKey fields of plan entries whose key
+	// changed.
+	KeyNormalizer func(string) string
+
+	// LastAppliedPath, when set, names the snapshot of last-applied records
+	// that apply.Run writes (see apply.RunParams.LastAppliedPath). Generate
+	// then diffs three ways: fields the CSV has not changed since the last
+	// apply keep their remote value, so changes made by other systems are
+	// not reverted, and fields changed on both sides are reported in
+	// Plan.Conflicts and resolved by OnConflict. A missing snapshot means a
+	// plain two-way diff. Records already in sync are listed in
+	// Plan.InSync, so apply.Run records them too. Sensitive and interpolated columns are always
+	// diffed two-way, as the snapshot does not hold their values.
+	LastAppliedPath string
+	OnConflict      types.ConflictPolicy
+
+	// Less orders every plan section by key, e.g. to list records by a
+	// numeric ID; nil sorts keys in string order. The printed plan, the
+	// plan file and the non-layered apply order follow it, and identical
+	// inputs always produce a byte-identical plan file (with sensitive
+	// columns, only when DigestKey is set).
+	Less func(a, b string) bool
+
+	// OnDecodeError controls how CSV cells that fail to decode are handled.
+	// The zero value (DecodeErrorFailFast) aborts at the first bad cell.
+	// DecodeErrorFailAll reports every bad cell at once; DecodeErrorIgnoreRow
+	// moves bad rows into Plan.Ignores with the decode error as the reason.
+	OnDecodeError types.DecodeErrorPolicy
+
+	// Duplicates decides what happens when a key appears on more than one
+	// CSV row. The zero value (DuplicateLastWins) keeps the row read last;
+	// DuplicateError and DuplicateMerge report every duplicated key with the
+	// file:line of each occurrence.
+	Duplicates input.DuplicatePolicy
+
+	// CaseInsensitiveHeaders matches CSV headers to `csv` tag names and
+	// aliases ignoring case and surrounding or repeated whitespace.
+	CaseInsensitiveHeaders bool
+
+	// CSVOptions describes the CSV dialect (delimiter, comments, quoting,
+	// encoding). The zero value reads standard comma-separated UTF-8 files.
+	CSVOptions input.CSVOptions
+
+	// FS, if set, is the file system CSVPath is read from, e.g. an embed.FS
+	// compiled into the binary, an fstest.MapFS in tests, or an archive
+	// opened with input.OpenArchive. CSVPath is then a slash-separated path
+	// within FS ("." for its root). Nil reads the operating system's files.
+	FS fs.FS
+
+	// IncludeGlobs, ExcludeGlobs and NonRecursive select which files under
+	// CSVPath are loaded; see input.LoadOptions. Patterns are slash-separated
+	// paths relative to CSVPath where "**" matches any number of directories,
+	// e.g. IncludeGlobs {"prod/**/*.csv"} or ExcludeGlobs {"scratch/**"}.
+	// Files load in lexical path order, so with DuplicateLastWins the file
+	// sorting last wins.
+	IncludeGlobs []string
+	ExcludeGlobs []string
+	NonRecursive bool
+
+	// OverlayPaths, when set, are directories applied in order on top of
+	// CSVPath, the base: overlay rows patch the columns they contain for
+	// their key, add new keys, or remove a key when their TombstoneColumn
+	// cell is true (default column "_delete"). The merged records are the
+	// desired state. See input.LoadCSVOverlaysToMap.
+	OverlayPaths    []string
+	TombstoneColumn string
+
+	// Interpolation, when set, expands `${ENV_VAR}` and `${secret:path}`
+	// references in string cells before records are validated and diffed.
+	// Interpolated columns are listed in Plan.Sensitive and shown as
+	// "(sensitive)"; the plan file keeps the references instead of the
+	// values, so apply.RunParams.Interpolation must be set to apply it.
+	Interpolation *input.Interpolation
+
+	// SensitiveFields names columns to treat as secrets in addition to those
+	// tagged `csv:"<column>,sensitive"`. Their field changes are recorded as
+	// digests, they print as "(sensitive)", and the plan file stores them
+	// redacted with a digest per key (Plan.Digests); apply.Run reloads the
+	// real values through RunParams.LoadLocalRecords.
+	SensitiveFields []string
+
+	// DigestKey keys the digests of sensitive values, and should be kept
+	// out of the plan file, e.g. as a CI secret; apply.RunParams.DigestKey
+	// must hold the same key. Without it each plan draws a random salt
+	// (Plan.DigestSalt), which stops precomputed guesses but still lets
+	// anyone holding the plan file test guesses of a value against its
+	// digest, and makes the plan file differ on every run.
+	DigestKey []byte
+
+	// IgnoreUnset enables partial management: CSV files may omit columns,
+	// and cells equal to UnsetSentinel (when non-empty) are treated like
+	// omitted ones. Such unset columns are taken from the remote record
+	// before validation and diffing (see diff.FillUnset), so other systems
+	// can own them. New records get the column's default or zero value.
+	// Unset sensitive columns are listed in Plan.Unset; applying such a plan
+	// requires apply.RunParams.LoadRemoteRecords.
+	IgnoreUnset   bool
+	UnsetSentinel string
+
+	// DeletionPolicy decides whether remote records missing from the CSVs
+	// are deleted. The zero value (DeletionAllow) deletes them;
+	// DeletionNever makes the plan additive-only.
+	DeletionPolicy types.DeletionPolicy
+
+	// OwnsRecord, when non-nil, limits deletions to remote records it
+	// reports as managed by planear, e.g. those labelled managed_by=planear.
+	// Other remote records missing from the CSVs are left alone.
+	OwnsRecord func(T) bool
+
+	// PreventDestroy, when non-nil, protects the remote records it matches:
+	// a plan deleting any of them prints, then fails with a
+	// *PreventDestroyError without writing the plan file.
+	PreventDestroy func(T) bool
+
+	// MaxDeletions and MaxDeletionsPercent (of the remote records) cap the
+	// number of deletions, guarding against a missing or truncated CSV
+	// file. A plan over either limit prints, then fails with a
+	// *DeletionLimitError without writing the plan file. Zero disables a
+	// limit.
+	MaxDeletions        int
+	MaxDeletionsPercent float64
 }
 
 func Generate[T any](params GenerateParams[T]) (*types.Plan[T], error) {
@@ -51,10 +217,57 @@ func Generate[T any](params GenerateParams[T]) (*types.Plan[T], error) {
 		return nil, fmt.Errorf("FormatKeyFunc is required")
 	}
 
-	localRecords, err := input.LoadCSVDirectoryToMap(params.CSVPath, params.ExtractKeyFunc)
+	sensitive, err := sensitiveFieldColumns[T](params.SensitiveFields)
+	if err != nil {
+		return nil, err
+	}
+
+	loadOpts := input.LoadOptions{Duplicates: params.Duplicates}
+	loadOpts.Lenient = params.OnDecodeError != types.DecodeErrorFailFast
+	loadOpts.CaseInsensitiveHeaders = params.CaseInsensitiveHeaders
+	loadOpts.CSV = params.CSVOptions
+	loadOpts.FS = params.FS
+	loadOpts.IncludeGlobs = params.IncludeGlobs
+	loadOpts.ExcludeGlobs = params.ExcludeGlobs
+	loadOpts.NonRecursive = params.NonRecursive
+	loadOpts.Interpolation = params.Interpolation
+	loadOpts.IgnoreUnset = params.IgnoreUnset
+	loadOpts.UnsetSentinel = params.UnsetSentinel
+
+	// templates holds the raw `${...}` cells of interpolated records by key.
+	var templates map[string]map[string]string
+	if params.Interpolation != nil {
+		templates = map[string]map[string]string{}
+		loadOpts.OnInterpolated = func(key any, t map[string]string) {
+			templates[key.(string)] = t
+		}
+	}
+
+	// unset holds the columns each local record leaves to the remote one.
+	var unset map[string][]string
+	if params.IgnoreUnset {
+		unset = map[string][]string{}
+		loadOpts.OnUnset = func(key any, columns []string) {
+			unset[key.(string)] = columns
+		}
+	}
+
+	var localRecords map[string]T
+	if len(params.OverlayPaths) > 0 {
+		localRecords, err = input.LoadCSVOverlaysToMap(params.CSVPath, params.OverlayPaths, params.ExtractKeyFunc, input.OverlayOptions{
+			LoadOptions:     loadOpts,
+			TombstoneColumn: params.TombstoneColumn,
+		})
+	} else {
+		localRecords, err = input.LoadCSVDirectoryToMapWithOptions(params.CSVPath, params.ExtractKeyFunc, loadOpts)
+	}
+	var decodeIgnores []types.RecordIgnored[T]
+	if decodeErrs, ok := err.(input.DecodeErrors); ok && params.OnDecodeError == types.DecodeErrorIgnoreRow {
+		decodeIgnores, err = decodeErrorIgnores(decodeErrs, params.ExtractKeyFunc)
+	}
 	if err != nil {
 		fmt.Printf("%sfailed to load local CSV records: %v%s", constants.ColorRed, err, constants.ColorReset)
-		return nil, fmt.Errorf("failed to load local CSV records: %v", err)
+		return nil, fmt.Errorf("failed to load local CSV records: %w", err)
 	}
 
 	remoteRecords, err := params.LoadRemoteRecords()
@@ -63,28 +276,109 @@ func Generate[T any](params GenerateParams[T]) (*types.Plan[T], error) {
 		return nil, fmt.Errorf("failed to load remote records: %v", err)
 	}
 
-	plan, err := diff.ComputePlanDiff(localRecords, remoteRecords, params.ValidateRecord)
+	dependsOn := params.DependsOn
+	var localKeys, remoteKeys map[string]string
+	if params.KeyNormalizer != nil {
+		localRecords, localKeys, err = normalizeKeys(localRecords, params.KeyNormalizer, "local")
+		if err == nil {
+			remoteRecords, remoteKeys, err = normalizeKeys(remoteRecords, params.KeyNormalizer, "remote")
+		}
+		if err != nil {
+			fmt.Printf("%skey normalization failed: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("key normalization failed: %w", err)
+		}
+		templates = rekey(templates, params.KeyNormalizer)
+		unset = rekey(unset, params.KeyNormalizer)
+		for i, ig := range decodeIgnores {
+			if key := params.KeyNormalizer(ig.Key); key != ig.Key {
+				decodeIgnores[i].Key, decodeIgnores[i].LocalKey = key, ig.Key
+			}
+		}
+		if dependsOn != nil {
+			dependsOn = normalizedDependsOn(dependsOn, params.KeyNormalizer)
+		}
+	}
+
+	var base map[string]T
+	if params.LastAppliedPath != "" {
+		if base, err = loadLastApplied(params.LastAppliedPath, remoteRecords, sensitive, templates); err != nil {
+			fmt.Printf("%sfailed to load last-applied snapshot: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("failed to load last-applied snapshot: %v", err)
+		}
+	}
+
+	// Sensitive values are digested as read from the CSV, which is what
+	// apply.Run reloads, so rawLocal keeps them before diff.Prepare.
+	rawLocal, rawRemote := localRecords, remoteRecords
+	localRecords, remoteRecords, opts, err := diff.Prepare(localRecords, remoteRecords, diff.Options[T]{
+		Normalize:  params.Normalize,
+		Unset:      unset,
+		Base:       base,
+		OnConflict: params.OnConflict,
+		Less:       params.Less,
+	})
+	var plan types.Plan[T]
+	if err == nil {
+		plan, err = diff.ComputePlanDiffWithOptions(localRecords, remoteRecords, params.ValidateRecord, opts)
+	}
 	if err != nil {
 		fmt.Printf("%serror generating plan diff: %v%s", constants.ColorRed, err, constants.ColorReset)
 		return nil, fmt.Errorf("error generating plan diff: %v", err)
 	}
+	if params.KeyNormalizer != nil {
+		plan = withoutKeyChanges(plan, params.ExtractKeyFunc, params.KeyNormalizer)
+		plan = withOriginalKeys(plan, localKeys, remoteKeys)
+	}
+	if len(decodeIgnores) > 0 {
+		plan = withDecodeIgnores(plan, decodeIgnores)
+	}
+	plan = filterDeletions(plan, params.DeletionPolicy, params.OwnsRecord)
+	if params.ValidateSet != nil {
+		if plan, err = validateSet(plan, localRecords, params.ValidateSet, params.OnSetValidationError); err != nil {
+			fmt.Printf("%scross-record validation failed: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("cross-record validation failed: %w", err)
+		}
+	}
+	if !params.Target.IsZero() {
+		if plan, err = applyTarget(plan, params.Target, localRecords, remoteRecords, dependsOn); err != nil {
+			fmt.Printf("%sfailed to apply target: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("failed to apply target: %w", err)
+		}
+		fmt.Printf("%sWarning: target is in effect; the plan may be incomplete%s\n", constants.ColorYellow, constants.ColorReset)
+	}
+	if params.LastAppliedPath != "" {
+		if plan.InSync, err = inSyncRecords(plan, localRecords, remoteRecords, templates); err != nil {
+			fmt.Printf("%serror generating plan diff: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("error generating plan diff: %v", err)
+		}
+	}
+	plan.Sensitive = sensitiveColumns(plan, templates)
+	var digester schema.Digester
+	if len(sensitive) > 0 {
+		plan.SensitiveColumns = sensitive
+		plan.Unset = unsetSensitive(plan, unset)
+		if len(params.DigestKey) == 0 {
+			plan.DigestSalt, err = schema.NewSalt()
+		}
+		if err == nil {
+			digester, err = schema.NewDigester(plan.DigestSalt, params.DigestKey)
+		}
+		if err == nil {
+			plan, err = digestChanges(plan, digester)
+		}
+		if err != nil {
+			fmt.Printf("%serror generating plan diff: %v%s", constants.ColorRed, err, constants.ColorReset)
+			return nil, fmt.Errorf("error generating plan diff: %v", err)
+		}
+	}
 
-	if plan.IsEmpty() {
+	// Decode and set-validation ignores are added after the diff sorted it.
+	plan.Sort(params.Less)
+
+	if plan.IsEmpty() && len(plan.Conflicts) == 0 {
 		fmt.Printf("%sNo changes required%s\n", constants.ColorGreen, constants.ColorReset)
-		if params.OutputFilePath != "" {
-			info, err := os.Stat(params.OutputFilePath)
-			if err == nil {
-				if !info.IsDir() {
-					if err := os.Remove(params.OutputFilePath); err != nil {
-						fmt.Printf("%sfailed to remove stale plan file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
-						return nil, fmt.Errorf("failed to remove stale plan file: %v", err)
-					}
-					fmt.Printf("%sWarning: removed stale plan file at %s%s\n", constants.ColorYellow, params.OutputFilePath, constants.ColorReset)
-				}
-			} else if !os.IsNotExist(err) {
-				fmt.Printf("%sfailed to check for stale plan file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
-				return nil, fmt.Errorf("failed to check for stale plan file: %v", err)
-			}
+		if err := removeStalePlanFile(params.OutputFilePath); err != nil {
+			return nil, err
 		}
 		return &plan, nil
 	}
@@ -92,8 +386,20 @@ func Generate[T any](params GenerateParams[T]) (*types.Plan[T], error) {
 	planDescription := formatters.FormatPlan(plan, params.FormatRecordFunc, params.FormatKeyFunc)
 	fmt.Print(planDescription)
 
-	if params.DependsOn != nil {
-		layers, err := ComputeLayers(plan, params.DependsOn)
+	err = checkDeletions(plan, len(remoteRecords), params.PreventDestroy, params.MaxDeletions, params.MaxDeletionsPercent)
+	if err == nil {
+		err = checkIgnores(plan, params.IgnorePolicy, params.IgnoreThreshold)
+	}
+	if err != nil {
+		fmt.Printf("%splan rejected: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+		if err := removeStalePlanFile(params.OutputFilePath); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("plan rejected: %w", err)
+	}
+
+	if dependsOn != nil {
+		layers, err := ComputeLayers(plan, dependsOn)
 		if err != nil {
 			fmt.Printf("%sfailed to compute layered plan: %v%s", constants.ColorRed, err, constants.ColorReset)
 			return nil, fmt.Errorf("failed to compute layered plan: %v", err)
@@ -101,9 +407,39 @@ func Generate[T any](params GenerateParams[T]) (*types.Plan[T], error) {
 		plan.Layers = layers
 	}
 
-	if err := utils.WriteJSONFile(params.OutputFilePath, "plan file", plan); err != nil {
+	planFile, err := withTemplates(plan, templates)
+	if err == nil {
+		planFile, err = withDigests(planFile, digester, rawLocal, rawRemote)
+	}
+	if err != nil {
+		fmt.Printf("%sfailed to prepare plan file: %v%s", constants.ColorRed, err, constants.ColorReset)
+		return nil, fmt.Errorf("failed to prepare plan file: %v", err)
+	}
+	if err := utils.WriteJSONFile(params.OutputFilePath, "plan file", planFile); err != nil {
 		fmt.Printf("%sfailed to write plan to file: %v%s", constants.ColorRed, err, constants.ColorReset)
 		return nil, fmt.Errorf("failed to write plan to file: %v", err)
 	}
 	return &plan, nil
 }
+
+// removeStalePlanFile deletes a plan file left at path by an earlier run, so
+// it cannot be applied by mistake when no new plan is written.
+func removeStalePlanFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.IsDir() {
+			if err := os.Remove(path); err != nil {
+				fmt.Printf("%sfailed to remove stale plan file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+				return fmt.Errorf("failed to remove stale plan file: %v", err)
+			}
+			fmt.Printf("%sWarning: removed stale plan file at %s%s\n", constants.ColorYellow, path, constants.ColorReset)
+		}
+	} else if !os.IsNotExist(err) {
+		fmt.Printf("%sfailed to check for stale plan file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+		return fmt.Errorf("failed to check for stale plan file: %v", err)
+	}
+	return nil
+}
@@ -1,13 +1,24 @@
 package plan_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/algebananazzzzz/planear/pkg/core/plan"
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/pkg/validate"
 	"github.com/algebananazzzzz/planear/testutils"
 	"github.com/stretchr/testify/require"
 )
@@ -404,3 +415,916 @@ func TestGeneratePlan_NoDependsOn_LayersNil(t *testing.T) {
 	require.NoError(t, err)
 	require.Nil(t, result.Layers)
 }
+
+type ScoredRecord struct {
+	ID    string `csv:"id"`
+	Score int    `csv:"score"`
+}
+
+func scoredParams(dir string, remote map[string]ScoredRecord) plan.GenerateParams[ScoredRecord] {
+	return plan.GenerateParams[ScoredRecord]{
+		CSVPath:           dir,
+		OutputFilePath:    filepath.Join(dir, "plan.json"),
+		FormatRecordFunc:  func(r ScoredRecord) string { return r.ID },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(r ScoredRecord) string { return r.ID },
+		LoadRemoteRecords: func() (map[string]ScoredRecord, error) { return remote, nil },
+		ValidateRecord:    testutils.NoopValidator[ScoredRecord](),
+	}
+}
+
+func TestGeneratePlan_DecodeErrorFailAll(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "scores.csv", []byte("id,score\n1,x\n2,2\n3,y\n"))
+
+	params := scoredParams(tmpDir, nil)
+	params.OnDecodeError = types.DecodeErrorFailAll
+
+	_, err := plan.Generate(params)
+	require.ErrorContains(t, err, "2 CSV decode error(s)")
+
+	var errs input.DecodeErrors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, 2, errs[0].Line)
+	require.Equal(t, 4, errs[1].Line)
+}
+
+func TestGeneratePlan_DecodeErrorIgnoreRow(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "scores.csv", []byte("id,score\n1,x\n2,2\n,y\n"))
+
+	remote := map[string]ScoredRecord{
+		"1": {ID: "1", Score: 1},
+		"9": {ID: "9", Score: 9},
+	}
+	params := scoredParams(tmpDir, remote)
+	params.OnDecodeError = types.DecodeErrorIgnoreRow
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+
+	require.Len(t, result.Additions, 1)
+	require.Equal(t, "2", result.Additions[0].Key)
+
+	// The remote copy of a row that failed to decode is protected from deletion.
+	require.Len(t, result.Deletions, 1)
+	require.Equal(t, "9", result.Deletions[0].Key)
+
+	// Ignores are sorted by key, and "/tmp/..." sorts before "1".
+	require.Len(t, result.Ignores, 2)
+	require.Equal(t, filepath.Join(tmpDir, "scores.csv")+":4", result.Ignores[0].Key)
+	require.Equal(t, "1", result.Ignores[1].Key)
+	require.Contains(t, result.Ignores[1].Reason, "invalid int value for field 'score' at row 2")
+}
+
+func TestGeneratePlan_DecodeErrorIgnoreRow_FileErrorsAbort(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "scores.csv", []byte("id\n1\n"))
+
+	params := scoredParams(tmpDir, nil)
+	params.OnDecodeError = types.DecodeErrorIgnoreRow
+
+	_, err := plan.Generate(params)
+	require.ErrorContains(t, err, "missing required column: score")
+}
+
+func TestGeneratePlan_DuplicateKeysError(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "team_a.csv", []byte("id,score\n1,10\n"))
+	testutils.CreateMockFile(t, tmpDir, "team_b.csv", []byte("id,score\n1,20\n"))
+
+	params := scoredParams(tmpDir, nil)
+	params.Duplicates = input.DuplicateError
+
+	_, err := plan.Generate(params)
+	require.ErrorContains(t, err, "failed to load local CSV records")
+
+	var dupErr *input.DuplicateKeyError
+	require.ErrorAs(t, err, &dupErr)
+	require.Len(t, dupErr.Duplicates[0].Locations, 2)
+	require.False(t, testutils.FileExists(t, params.OutputFilePath))
+}
+
+func TestGeneratePlan_LoadsFromFS(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	fsys := fstest.MapFS{
+		"state/scores.csv":    {Data: []byte("id,score\n1,10\n2,20\n")},
+		"state/notes.txt":     {Data: []byte("not a csv")},
+		"elsewhere/other.csv": {Data: []byte("id,score\n3,30\n")},
+	}
+
+	params := scoredParams(tmpDir, map[string]ScoredRecord{"1": {ID: "1", Score: 5}})
+	params.FS = fsys
+	params.CSVPath = "state"
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Additions, 1)
+	require.Equal(t, "2", result.Additions[0].Key)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, "1", result.Updates[0].Key)
+}
+
+func TestGeneratePlan_IncludeExcludeGlobs(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	fsys := fstest.MapFS{
+		"prod/scores.csv":    {Data: []byte("id,score\n1,10\n")},
+		"prod/scratch/x.csv": {Data: []byte("id,score\n2,20\n")},
+		"staging/scores.csv": {Data: []byte("id,score\n3,30\n")},
+	}
+
+	params := scoredParams(tmpDir, nil)
+	params.FS = fsys
+	params.CSVPath = "."
+	params.IncludeGlobs = []string{"prod/**"}
+	params.ExcludeGlobs = []string{"**/scratch/**"}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Additions, 1)
+	require.Equal(t, "1", result.Additions[0].Key)
+}
+
+func TestGeneratePlan_Overlays(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	fsys := fstest.MapFS{
+		"base/scores.csv":    {Data: []byte("id,score\n1,10\n2,20\n3,30\n")},
+		"staging/scores.csv": {Data: []byte("id,score,_delete\n2,,true\n3,33,\n")},
+	}
+	remote := map[string]ScoredRecord{
+		"1": {ID: "1", Score: 10},
+		"2": {ID: "2", Score: 20},
+		"3": {ID: "3", Score: 30},
+	}
+
+	params := scoredParams(tmpDir, remote)
+	params.FS = fsys
+	params.CSVPath = "base"
+	params.OverlayPaths = []string{"staging"}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, "3", result.Updates[0].Key)
+	require.Len(t, result.Deletions, 1)
+	require.Equal(t, "2", result.Deletions[0].Key)
+	require.Empty(t, result.Additions)
+}
+
+func TestGeneratePlan_InterpolationKeepsSecretsOutOfPlanFile(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	outputPlanFile := filepath.Join(tmpDir, "plan.json")
+	testutils.CreateMockFile(t, tmpDir, "plan.csv", []byte("id,value\n1,${secret:api/key}\n2,plain\n"))
+	remote := map[string]Record{"1": {ID: "1", Value: "old-key"}}
+
+	params := plan.GenerateParams[Record]{
+		CSVPath:           tmpDir,
+		OutputFilePath:    outputPlanFile,
+		FormatRecordFunc:  formatRecord,
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    extractKey,
+		LoadRemoteRecords: func() (map[string]Record, error) { return remote, nil },
+		ValidateRecord:    noopValidator,
+		Interpolation: &input.Interpolation{
+			Secrets: input.SecretResolverFunc(func(path string) (string, error) { return "s3cr3t", nil }),
+		},
+	}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, "s3cr3t", result.Updates[0].New.Value)
+	require.Equal(t, map[string][]string{"1": {"value"}}, result.Sensitive)
+
+	data, err := os.ReadFile(outputPlanFile)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "${secret:api/key}")
+	require.NotContains(t, string(data), "s3cr3t")
+	require.NotContains(t, string(data), "old-key")
+}
+
+func TestGeneratePlan_DecodeErrorIgnoreRowKeepsSecretsHidden(t *testing.T) {
+	type Token struct {
+		ID    string `csv:"id"`
+		Token string `csv:"token"`
+		Uses  int    `csv:"uses"`
+	}
+	tmpDir := testutils.NewTestDir(t)
+	outputPlanFile := filepath.Join(tmpDir, "plan.json")
+	testutils.CreateMockFile(t, tmpDir, "tokens.csv", []byte("id,token,uses\n1,${secret:api/token},many\n"))
+
+	params := plan.GenerateParams[Token]{
+		CSVPath:           tmpDir,
+		OutputFilePath:    outputPlanFile,
+		FormatRecordFunc:  func(r Token) string { return r.ID + " token=" + r.Token },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(r Token) string { return r.ID },
+		LoadRemoteRecords: func() (map[string]Token, error) { return nil, nil },
+		ValidateRecord:    testutils.NoopValidator[Token](),
+		OnDecodeError:     types.DecodeErrorIgnoreRow,
+		Interpolation: &input.Interpolation{
+			Secrets: input.SecretResolverFunc(func(path string) (string, error) { return "HUNTER2", nil }),
+		},
+	}
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	result, err := plan.Generate(params)
+	w.Close()
+	os.Stdout = stdout
+	var out bytes.Buffer
+	_, _ = io.Copy(&out, r)
+
+	require.NoError(t, err)
+	require.Len(t, result.Ignores, 1)
+	require.Equal(t, "${secret:api/token}", result.Ignores[0].Record.Token)
+	require.Contains(t, out.String(), "token=${secret:api/token}")
+	require.NotContains(t, out.String(), "HUNTER2")
+
+	data, err := os.ReadFile(outputPlanFile)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "${secret:api/token}")
+	require.NotContains(t, string(data), "HUNTER2")
+}
+
+type Account struct {
+	ID       string   `csv:"id"`
+	Password string   `csv:"password,sensitive"`
+	Roles    []string `csv:"roles,split=|"`
+}
+
+func accountParams(dir string, remote map[string]Account) plan.GenerateParams[Account] {
+	return plan.GenerateParams[Account]{
+		CSVPath:           dir,
+		OutputFilePath:    filepath.Join(dir, "out", "plan.json"),
+		FormatRecordFunc:  func(a Account) string { return a.ID + ":" + a.Password },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(a Account) string { return a.ID },
+		LoadRemoteRecords: func() (map[string]Account, error) { return remote, nil },
+		ValidateRecord:    func(Account) error { return nil },
+	}
+}
+
+func TestGeneratePlan_SensitiveFieldsStoredAsDigests(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "accounts.csv", []byte("id,password,roles\n1,new-pass,admin\n2,fresh-pass,dev|ops\n"))
+	remote := map[string]Account{
+		"1": {ID: "1", Password: "old-pass", Roles: []string{"admin"}},
+		"3": {ID: "3", Password: "gone-pass"},
+	}
+
+	params := accountParams(tmpDir, remote)
+	params.SensitiveFields = []string{"roles"}
+	params.DigestKey = []byte("ci-secret")
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"password", "roles"}, result.SensitiveColumns)
+	require.Equal(t, "new-pass", result.Updates[0].New.Password)
+
+	// Digests are keyed by the DigestKey; no salt is needed.
+	require.Empty(t, result.DigestSalt)
+	digester, err := schema.NewDigester("", params.DigestKey)
+	require.NoError(t, err)
+	require.Equal(t, []types.FieldChange{{
+		Field:    "password",
+		OldValue: digester.Digest("old-pass"),
+		NewValue: digester.Digest("new-pass"),
+	}}, result.Updates[0].Changes)
+
+	data, err := os.ReadFile(params.OutputFilePath)
+	require.NoError(t, err)
+	for _, secret := range []string{"new-pass", "old-pass", "fresh-pass", "gone-pass", "ops"} {
+		require.NotContains(t, string(data), secret)
+	}
+
+	var written types.Plan[Account]
+	require.NoError(t, json.Unmarshal(data, &written))
+	require.Equal(t, map[string]map[string]string{
+		"1": {"password": digester.Digest("new-pass"), "roles": digester.Digest([]string{"admin"})},
+		"2": {"password": digester.Digest("fresh-pass"), "roles": digester.Digest([]string{"dev", "ops"})},
+	}, written.Digests)
+
+	unkeyed, err := schema.NewDigester("", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, unkeyed.Digest("new-pass"), written.Digests["1"]["password"])
+
+	// With a DigestKey the plan file is reproducible.
+	_, err = plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(testutils.ReadFile(t, params.OutputFilePath)))
+}
+
+func TestGeneratePlan_SensitiveFieldsCollapseElementChanges(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "accounts.csv", []byte("id,password,roles\n1,p,admin|dev\n"))
+	remote := map[string]Account{"1": {ID: "1", Password: "p", Roles: []string{"admin", "ops", "qa"}}}
+
+	params := accountParams(tmpDir, remote)
+	params.SensitiveFields = []string{"roles"}
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	// Without a DigestKey the digests are keyed by a random salt.
+	require.Len(t, result.DigestSalt, 64)
+	digester, err := schema.NewDigester(result.DigestSalt, nil)
+	require.NoError(t, err)
+	require.Equal(t, []types.FieldChange{{
+		Field:    "roles",
+		OldValue: digester.Digest([]string{"admin", "ops", "qa"}),
+		NewValue: digester.Digest([]string{"admin", "dev"}),
+	}}, result.Updates[0].Changes)
+}
+
+func TestGeneratePlan_SensitiveFieldsUnknownColumn(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	params := accountParams(tmpDir, nil)
+	params.SensitiveFields = []string{"secret"}
+
+	_, err := plan.Generate(params)
+	require.ErrorContains(t, err, `SensitiveFields: "secret" is not a column of plan_test.Account`)
+}
+
+func TestGeneratePlan_TagValidationListsEveryProblem(t *testing.T) {
+	type Member struct {
+		ID    string `csv:"id" validate:"required"`
+		Email string `csv:"email" validate:"required,email"`
+		Tier  string `csv:"tier" validate:"oneof=free|pro"`
+	}
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,email,tier\n1,ada@example.com,pro\n2,bob,gold\n"))
+
+	result, err := plan.Generate(plan.GenerateParams[Member]{
+		CSVPath:           tmpDir,
+		OutputFilePath:    filepath.Join(tmpDir, "plan.json"),
+		FormatRecordFunc:  func(m Member) string { return m.ID },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(m Member) string { return m.ID },
+		LoadRemoteRecords: func() (map[string]Member, error) { return nil, nil },
+		ValidateRecord:    validate.Struct[Member],
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Additions, 1)
+	require.Len(t, result.Ignores, 1)
+	require.Equal(t, "email: must be a valid email address; tier: must be one of free, pro", result.Ignores[0].Reason)
+}
+
+type Login struct {
+	ID       string `csv:"id"`
+	Username string `csv:"username"`
+}
+
+// uniqueUsernames rejects every record sharing its username with another.
+func uniqueUsernames(records map[string]Login) map[string]error {
+	owners := map[string][]string{}
+	for key, r := range records {
+		owners[r.Username] = append(owners[r.Username], key)
+	}
+	errs := map[string]error{}
+	for name, keys := range owners {
+		if len(keys) > 1 {
+			for _, key := range keys {
+				errs[key] = fmt.Errorf("username %q is not unique", name)
+			}
+		}
+	}
+	return errs
+}
+
+func loginParams(dir string, remote map[string]Login) plan.GenerateParams[Login] {
+	return plan.GenerateParams[Login]{
+		CSVPath:           dir,
+		OutputFilePath:    filepath.Join(dir, "plan.json"),
+		FormatRecordFunc:  func(l Login) string { return l.ID + "=" + l.Username },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(l Login) string { return l.ID },
+		LoadRemoteRecords: func() (map[string]Login, error) { return remote, nil },
+		ValidateRecord: func(l Login) error {
+			if l.Username == "" {
+				return errors.New("username is required")
+			}
+			return nil
+		},
+		ValidateSet: uniqueUsernames,
+	}
+}
+
+func TestGeneratePlan_ValidateSetIgnoresRejectedKeys(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "logins.csv", []byte("id,username\n1,ada\n2,bob\n3,ada\n4,\n5,\n"))
+	remote := map[string]Login{"3": {ID: "3", Username: "ada3"}}
+
+	var seen map[string]Login
+	params := loginParams(tmpDir, remote)
+	validateSet := params.ValidateSet
+	params.ValidateSet = func(records map[string]Login) map[string]error {
+		seen = records
+		return validateSet(records)
+	}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, sortedKeys(seen), "records failing ValidateRecord are not passed to ValidateSet")
+	require.Len(t, result.Additions, 1)
+	require.Equal(t, "2", result.Additions[0].Key)
+	require.Empty(t, result.Updates)
+	require.Empty(t, result.Deletions)
+
+	reasons := map[string]string{}
+	for _, ig := range result.Ignores {
+		reasons[ig.Key] = ig.Reason
+	}
+	require.Equal(t, map[string]string{
+		"1": `username "ada" is not unique`,
+		"3": `username "ada" is not unique`,
+		"4": "username is required",
+		"5": "username is required",
+	}, reasons)
+}
+
+func TestGeneratePlan_ValidateSetFailPolicy(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "logins.csv", []byte("id,username\n1,ada\n2,bob\n3,ada\n"))
+
+	params := loginParams(tmpDir, nil)
+	params.OnSetValidationError = types.SetValidationFail
+
+	_, err := plan.Generate(params)
+	require.EqualError(t, err, `cross-record validation failed: ValidateSet rejected 2 record(s): 1: username "ada" is not unique; 3: username "ada" is not unique`)
+	require.False(t, testutils.FileExists(t, params.OutputFilePath))
+}
+
+func TestGeneratePlan_ValidateSetUnknownKey(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "logins.csv", []byte("id,username\n1,ada\n"))
+
+	params := loginParams(tmpDir, nil)
+	params.ValidateSet = func(map[string]Login) map[string]error {
+		return map[string]error{"9": errors.New("nope")}
+	}
+
+	_, err := plan.Generate(params)
+	require.ErrorContains(t, err, `ValidateSet returned key "9", which is not a valid local record`)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestGeneratePlan_IgnorePolicy(t *testing.T) {
+	csv := []byte("id,username\n1,ada\n2,\n3,\n4,dan\n")
+
+	tests := []struct {
+		name      string
+		policy    types.IgnorePolicy
+		threshold int
+		wantErr   string
+	}{
+		{name: "allow", policy: types.IgnoreAllow},
+		{name: "fail if any", policy: types.IgnoreFailIfAny,
+			wantErr: "2 record(s) ignored, none allowed: 2 (username is required), 3 (username is required)"},
+		{name: "within threshold", policy: types.IgnoreFailAboveThreshold, threshold: 2},
+		{name: "above threshold", policy: types.IgnoreFailAboveThreshold, threshold: 1,
+			wantErr: "2 record(s) ignored, at most 1 allowed: 2 (username is required), 3 (username is required)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := testutils.NewTestDir(t)
+			testutils.CreateMockFile(t, tmpDir, "logins.csv", csv)
+			params := loginParams(tmpDir, nil)
+			params.IgnorePolicy = tt.policy
+			params.IgnoreThreshold = tt.threshold
+
+			result, err := plan.Generate(params)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				require.Len(t, result.Ignores, 2)
+				require.True(t, testutils.FileExists(t, params.OutputFilePath))
+				return
+			}
+
+			var ignoredErr *plan.IgnoredRecordsError
+			require.ErrorAs(t, err, &ignoredErr)
+			require.Equal(t, []string{"2", "3"}, ignoredErr.Keys)
+			require.Equal(t, "username is required", ignoredErr.Reasons["2"])
+			require.EqualError(t, ignoredErr, tt.wantErr)
+			require.False(t, testutils.FileExists(t, params.OutputFilePath))
+		})
+	}
+}
+
+func TestGeneratePlan_IgnorePolicyRemovesStalePlanFile(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "logins.csv", []byte("id,username\n1,\n"))
+	params := loginParams(tmpDir, nil)
+	params.OutputFilePath = testutils.CreateMockFile(t, tmpDir, "out/plan.json", []byte("{}"))
+	params.IgnorePolicy = types.IgnoreFailIfAny
+
+	_, err := plan.Generate(params)
+	require.Error(t, err)
+	require.False(t, testutils.FileExists(t, params.OutputFilePath))
+}
+
+func TestGeneratePlan_Normalize(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "logins.csv", []byte("id,username\n1,Ada\n2,Bob\n"))
+	remote := map[string]Login{"1": {ID: "1", Username: "ada"}, "2": {ID: "2", Username: "rob"}}
+
+	params := loginParams(tmpDir, remote)
+	params.Normalize = func(l Login) Login {
+		l.Username = strings.ToLower(l.Username)
+		return l
+	}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, []types.FieldChange{{Field: "username", OldValue: "rob", NewValue: "bob"}}, result.Updates[0].Changes)
+}
+
+type Member struct {
+	ID   string `csv:"id"`
+	Name string `csv:"name"`
+	Team string `csv:"team"`
+}
+
+func TestGeneratePlan_IgnoreUnsetKeepsRemoteValues(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "names.csv", []byte("id,name\n1,Ada\n2,Bob\n3,Cy\n"))
+	testutils.CreateMockFile(t, tmpDir, "teams.csv", []byte("id,name,team\n4,Di,*\n"))
+	remote := map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "eng"},
+		"2": {ID: "2", Name: "Robert", Team: "ops"},
+		"4": {ID: "4", Name: "Di", Team: "sales"},
+	}
+
+	params := plan.GenerateParams[Member]{
+		CSVPath:           tmpDir,
+		OutputFilePath:    filepath.Join(tmpDir, "out", "plan.json"),
+		FormatRecordFunc:  func(m Member) string { return m.Name },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(m Member) string { return m.ID },
+		LoadRemoteRecords: func() (map[string]Member, error) { return remote, nil },
+		ValidateRecord:    func(Member) error { return nil },
+		IgnoreUnset:       true,
+		UnsetSentinel:     "*",
+	}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, "2", result.Updates[0].Key)
+	require.Equal(t, []types.FieldChange{{Field: "name", OldValue: "Robert", NewValue: "Bob"}}, result.Updates[0].Changes)
+	require.Equal(t, Member{ID: "2", Name: "Bob", Team: "ops"}, result.Updates[0].New)
+	require.Equal(t, []types.RecordAddition[Member]{{Key: "3", New: Member{ID: "3", Name: "Cy"}}}, result.Additions)
+	require.Empty(t, result.Deletions)
+
+	params.IgnoreUnset = false
+	_, err = plan.Generate(params)
+	require.ErrorContains(t, err, "missing required column")
+}
+
+func memberParams(dir string, remote map[string]Member) plan.GenerateParams[Member] {
+	return plan.GenerateParams[Member]{
+		CSVPath:           dir,
+		OutputFilePath:    filepath.Join(dir, "out", "plan.json"),
+		FormatRecordFunc:  func(m Member) string { return m.Name },
+		FormatKeyFunc:     formatKey,
+		ExtractKeyFunc:    func(m Member) string { return m.ID },
+		LoadRemoteRecords: func() (map[string]Member, error) { return remote, nil },
+		ValidateRecord:    func(Member) error { return nil },
+	}
+}
+
+func remoteMembers(n int, team string) map[string]Member {
+	remote := map[string]Member{}
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprint(i)
+		remote[id] = Member{ID: id, Name: "m" + id, Team: team}
+	}
+	return remote
+}
+
+func TestGeneratePlan_DeletionNeverIsAdditiveOnly(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\n1,m1,eng\n9,new,eng\n"))
+
+	params := memberParams(tmpDir, remoteMembers(3, "eng"))
+	params.DeletionPolicy = types.DeletionNever
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Empty(t, result.Deletions)
+	require.Len(t, result.Additions, 1)
+}
+
+func TestGeneratePlan_OwnsRecordLimitsDeletions(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\n1,m1,eng\n"))
+	remote := remoteMembers(2, "eng")
+	remote["3"] = Member{ID: "3", Name: "m3", Team: "external"}
+
+	params := memberParams(tmpDir, remote)
+	params.OwnsRecord = func(m Member) bool { return m.Team != "external" }
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Deletions, 1)
+	require.Equal(t, "2", result.Deletions[0].Key)
+}
+
+func TestGeneratePlan_PreventDestroy(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\n1,m1,eng\n"))
+	remote := remoteMembers(3, "eng")
+	remote["3"] = Member{ID: "3", Name: "root", Team: "admin"}
+	remote["2"] = Member{ID: "2", Name: "ops", Team: "admin"}
+
+	params := memberParams(tmpDir, remote)
+	params.PreventDestroy = func(m Member) bool { return m.Team == "admin" }
+
+	_, err := plan.Generate(params)
+	var protected *plan.PreventDestroyError
+	require.ErrorAs(t, err, &protected)
+	require.Equal(t, []string{"2", "3"}, protected.Keys)
+	require.EqualError(t, err, "plan rejected: 2 protected record(s) would be deleted: 2, 3")
+	require.False(t, testutils.FileExists(t, params.OutputFilePath))
+}
+
+func TestGeneratePlan_MaxDeletions(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\n1,m1,eng\n2,m2,eng\n"))
+
+	params := memberParams(tmpDir, remoteMembers(10, "eng"))
+	params.MaxDeletions = 8
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Deletions, 8)
+
+	params.MaxDeletions = 7
+	_, err = plan.Generate(params)
+	var limit *plan.DeletionLimitError
+	require.ErrorAs(t, err, &limit)
+	require.EqualError(t, err, "plan rejected: 8 record(s) would be deleted, at most 7 allowed")
+	require.False(t, testutils.FileExists(t, params.OutputFilePath), "the stale plan file is removed")
+
+	params.MaxDeletions = 0
+	params.MaxDeletionsPercent = 50
+	_, err = plan.Generate(params)
+	require.EqualError(t, err, "plan rejected: 8 record(s) would be deleted, at most 50% of 10 remote record(s) allowed")
+
+	params.MaxDeletionsPercent = 80
+	_, err = plan.Generate(params)
+	require.NoError(t, err)
+}
+
+func targetParams(t *testing.T) plan.GenerateParams[PositionRec] {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.WriteCSVFile(t, tmpDir, "positions.csv", []PositionRec{
+		{ID: "Welfare-Member", Parent: "Welfare-Head"},
+		{ID: "Welfare-Head", Parent: "President"},
+		{ID: "President"},
+		{ID: "Treasurer", Parent: "President"},
+	})
+	remote := map[string]PositionRec{
+		"President": {ID: "President", Parent: "Board"},
+		"Secretary": {ID: "Secretary"},
+	}
+	return plan.GenerateParams[PositionRec]{
+		CSVPath:           tmpDir,
+		OutputFilePath:    filepath.Join(tmpDir, "plan.json"),
+		FormatRecordFunc:  func(p PositionRec) string { return p.ID },
+		FormatKeyFunc:     func(k string) string { return k },
+		ExtractKeyFunc:    posKey,
+		LoadRemoteRecords: func() (map[string]PositionRec, error) { return remote, nil },
+		ValidateRecord:    func(PositionRec) error { return nil },
+		DependsOn:         posDeps,
+	}
+}
+
+func planKeys[T any](p *types.Plan[T]) []string {
+	var keys []string
+	for _, a := range p.Additions {
+		keys = append(keys, "+"+a.Key)
+	}
+	for _, u := range p.Updates {
+		keys = append(keys, "~"+u.Key)
+	}
+	for _, d := range p.Deletions {
+		keys = append(keys, "-"+d.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestGeneratePlan_TargetPullsInDependencies(t *testing.T) {
+	params := targetParams(t)
+	params.Target = plan.Target[PositionRec]{Keys: []string{"Welfare-Member"}}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"+Welfare-Head", "+Welfare-Member", "~President"}, planKeys(result))
+	require.Equal(t, [][]types.LayerOp{
+		{{Kind: types.LayerOpUpdate, Key: "President"}},
+		{{Kind: types.LayerOpAdd, Key: "Welfare-Head"}},
+		{{Kind: types.LayerOpAdd, Key: "Welfare-Member"}},
+	}, result.Layers)
+
+	params.Target.NoDependencies = true
+	result, err = plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"+Welfare-Member"}, planKeys(result))
+}
+
+func TestGeneratePlan_TargetGlobsAndMatch(t *testing.T) {
+	params := targetParams(t)
+	params.DependsOn = nil
+	params.Target = plan.Target[PositionRec]{Globs: []string{"Welfare-*"}}
+
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"+Welfare-Head", "+Welfare-Member"}, planKeys(result))
+
+	params.Target = plan.Target[PositionRec]{
+		Match: func(_ string, local, remote *PositionRec) bool { return local == nil && remote != nil },
+	}
+	result, err = plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"-Secretary"}, planKeys(result))
+
+	params.Target = plan.Target[PositionRec]{Globs: []string{"["}}
+	_, err = plan.Generate(params)
+	require.ErrorContains(t, err, `failed to apply target: invalid target pattern "["`)
+}
+
+func TestGeneratePlan_KeyNormalizerMatchesKeys(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\nAda@Example.com,Ada,eng\nBob@Example.com,Bob,ops\ncy@example.com,Cy,ops\n"))
+	remote := map[string]Member{
+		"ada@example.com": {ID: "ada@example.com", Name: "Ada", Team: "eng"},
+		"BOB@EXAMPLE.COM": {ID: "BOB@EXAMPLE.COM", Name: "Bob", Team: "eng"},
+		"Old@example.com": {ID: "Old@example.com", Name: "Old"},
+	}
+
+	params := memberParams(tmpDir, remote)
+	params.KeyNormalizer = strings.ToLower
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"+cy@example.com", "-old@example.com", "~bob@example.com"}, planKeys(result))
+	require.Equal(t, "", result.Additions[0].LocalKey, "unchanged keys are not repeated")
+	require.Equal(t, "Bob@Example.com", result.Updates[0].LocalKey)
+	require.Equal(t, "BOB@EXAMPLE.COM", result.Updates[0].RemoteKey)
+	require.Equal(t, []types.FieldChange{{Field: "team", OldValue: "eng", NewValue: "ops"}}, result.Updates[0].Changes)
+	require.Equal(t, "Old@example.com", result.Deletions[0].RemoteKey)
+
+	var written types.Plan[Member]
+	data, err := os.ReadFile(params.OutputFilePath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &written))
+	require.Equal(t, "BOB@EXAMPLE.COM", written.Updates[0].RemoteKey)
+}
+
+func TestGeneratePlan_KeyNormalizerComparesKeyColumns(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\nAlice,Alice,eng\nJose\u0301,Jose,ops\n"))
+	remote := map[string]Member{
+		"alice":     {ID: "alice", Name: "Alice", Team: "eng"},
+		"Jos\u00e9": {ID: "Jos\u00e9", Name: "Jose", Team: "eng"},
+	}
+
+	params := memberParams(tmpDir, remote)
+	params.KeyNormalizer = func(key string) string {
+		// A stand-in for norm.NFC.String that composes the one accent used.
+		return strings.ToLower(strings.ReplaceAll(key, "e\u0301", "\u00e9"))
+	}
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"~jos\u00e9"}, planKeys(result))
+	require.Equal(t, []types.FieldChange{{Field: "team", OldValue: "eng", NewValue: "ops"}}, result.Updates[0].Changes)
+	require.Equal(t, "Jos\u00e9", result.Updates[0].New.ID, "the remote spelling of the key is kept")
+
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\nAlice,Alice,eng\nJose\u0301,Jose,eng\n"))
+	result, err = plan.Generate(params)
+	require.NoError(t, err)
+	require.True(t, result.IsEmpty())
+}
+
+func TestGeneratePlan_KeyNormalizerCollision(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\nada@example.com,Ada,eng\nADA@example.com,Ada,ops\n"))
+
+	params := memberParams(tmpDir, nil)
+	params.KeyNormalizer = strings.ToLower
+	_, err := plan.Generate(params)
+	require.EqualError(t, err, `key normalization failed: local keys "ADA@example.com" and "ada@example.com" both normalize to "ada@example.com"`)
+	require.False(t, testutils.FileExists(t, params.OutputFilePath))
+}
+
+func TestGeneratePlan_LastAppliedThreeWay(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte("id,name,team\n1,Ada,eng\n2,Bobby,eng\n3,Cy,ops\n"))
+	snapshot := testutils.WriteJSONFile(t, tmpDir, "last_applied.json", map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "eng"},
+		"2": {ID: "2", Name: "Bob", Team: "eng"},
+		"3": {ID: "3", Name: "Cy", Team: "eng"},
+	})
+	remote := map[string]Member{
+		"1": {ID: "1", Name: "Ada", Team: "sales"},
+		"2": {ID: "2", Name: "Bob", Team: "sales"},
+		"3": {ID: "3", Name: "Cy", Team: "sales"},
+	}
+
+	params := memberParams(tmpDir, remote)
+	params.LastAppliedPath = snapshot
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"~2"}, planKeys(result))
+	require.Equal(t, Member{ID: "2", Name: "Bobby", Team: "sales"}, result.Updates[0].New)
+	require.Equal(t, []types.RecordConflict{{
+		Key:    "3",
+		Fields: []types.FieldConflict{{Field: "team", Base: "eng", Local: "ops", Remote: "sales"}},
+	}}, result.Conflicts)
+
+	var written types.Plan[Member]
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, params.OutputFilePath), &written))
+	require.Len(t, written.Conflicts, 1)
+
+	// Without a snapshot the diff is two-way and reverts the remote changes.
+	params.LastAppliedPath = filepath.Join(tmpDir, "missing.json")
+	result, err = plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"~1", "~2", "~3"}, planKeys(result))
+	require.Empty(t, result.Conflicts)
+}
+
+func TestGeneratePlan_LastAppliedSensitiveColumnsDiffTwoWay(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, tmpDir, "accounts.csv", []byte("id,password,roles\n1,new,admin\n2,same,dev\n"))
+	snapshot := testutils.WriteJSONFile(t, tmpDir, "last_applied.json", map[string]Account{
+		"1": {ID: "1", Password: "(sensitive)", Roles: []string{"admin"}},
+	})
+
+	params := accountParams(tmpDir, map[string]Account{
+		"1": {ID: "1", Password: "old", Roles: []string{"admin"}},
+		"2": {ID: "2", Password: "same", Roles: []string{"dev"}},
+	})
+	params.LastAppliedPath = snapshot
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Len(t, result.Updates, 1)
+	require.Equal(t, "password", result.Updates[0].Changes[0].Field)
+	require.Empty(t, result.Conflicts)
+
+	// In-sync records are kept for the snapshot, redacted like the others.
+	var written types.Plan[Account]
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, params.OutputFilePath), &written))
+	require.Equal(t, map[string]Account{"2": {ID: "2", Password: "(sensitive)", Roles: []string{"dev"}}}, written.InSync)
+}
+
+func TestGeneratePlan_ReproduciblePlanFile(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	var csv strings.Builder
+	csv.WriteString("id,name,team\n")
+	remote := map[string]Member{}
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprint(i)
+		fmt.Fprintf(&csv, "%s,m%s,team%d\n", id, id, i%3)
+		remote[fmt.Sprint(i+25)] = Member{ID: fmt.Sprint(i + 25), Name: "m" + fmt.Sprint(i+25)}
+	}
+	testutils.CreateMockFile(t, tmpDir, "members.csv", []byte(csv.String()))
+
+	params := memberParams(tmpDir, remote)
+	params.DependsOn = func(m Member) []string { return []string{m.Team} }
+	generate := func() []byte {
+		_, err := plan.Generate(params)
+		require.NoError(t, err)
+		return testutils.ReadFile(t, params.OutputFilePath)
+	}
+	first := generate()
+	for i := 0; i < 5; i++ {
+		require.Equal(t, string(first), string(generate()))
+	}
+
+	var written types.Plan[Member]
+	require.NoError(t, json.Unmarshal(first, &written))
+	require.Equal(t, "0", written.Additions[0].Key)
+	require.Equal(t, "1", written.Additions[1].Key)
+	require.Equal(t, "10", written.Additions[2].Key)
+
+	params.Less = func(a, b string) bool {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x < y
+	}
+	result, err := plan.Generate(params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0", "1", "2"}, []string{result.Additions[0].Key, result.Additions[1].Key, result.Additions[2].Key})
+	require.Equal(t, "50", result.Deletions[0].Key)
+}
@@ -0,0 +1,67 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/algebananazzzzz/planear/pkg/constants"
+	"github.com/algebananazzzzz/planear/pkg/core/diff"
+)
+
+// StreamParams configures GenerateStream.
+type StreamParams[T any] struct {
+	OutputFilePath string        // Where to save the generated plan
+	ValidateRecord func(T) error // Validator for local records
+
+	// LocalRecords and RemoteRecords yield the desired and the actual
+	// records sorted by key (see diff.Iterator), e.g. from a sorted CSV
+	// export and an `ORDER BY` query. Neither is held in memory.
+	LocalRecords  diff.Iterator[T]
+	RemoteRecords diff.Iterator[T]
+}
+
+// GenerateStream generates a plan for data sets too large for Generate: it
+// merge-joins the key-sorted iterators with diff.StreamPlanDiff and writes
+// each entry to the plan file as soon as it is known, through a
+// StreamWriter, so memory use stays bounded however many records there are.
+// It prints a summary rather than every entry and supports none of the
+// GenerateParams options beyond validation; the plan file is applied with
+// apply.Run as usual.
+func GenerateStream[T any](params StreamParams[T]) (diff.StreamStats, error) {
+	if params.LocalRecords == nil {
+		return diff.StreamStats{}, fmt.Errorf("LocalRecords is required")
+	}
+	if params.RemoteRecords == nil {
+		return diff.StreamStats{}, fmt.Errorf("RemoteRecords is required")
+	}
+	if params.ValidateRecord == nil {
+		return diff.StreamStats{}, fmt.Errorf("ValidateRecord is required")
+	}
+
+	w, err := NewStreamWriter[T](params.OutputFilePath)
+	if err != nil {
+		fmt.Printf("%sfailed to write plan to file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+		return diff.StreamStats{}, fmt.Errorf("failed to write plan to file: %v", err)
+	}
+
+	stats, err := diff.StreamPlanDiff(params.LocalRecords, params.RemoteRecords, params.ValidateRecord, w)
+	if err != nil {
+		w.Abort()
+		fmt.Printf("%serror generating plan diff: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+		return stats, fmt.Errorf("error generating plan diff: %w", err)
+	}
+
+	if stats.Total() == 0 {
+		w.Abort()
+		fmt.Printf("%sNo changes required%s\n", constants.ColorGreen, constants.ColorReset)
+		return stats, removeStalePlanFile(params.OutputFilePath)
+	}
+
+	fmt.Printf("Summary: %d to add, %d to update, %d to remove, %d to ignore. Total: %d actions.\n",
+		stats.Additions, stats.Updates, stats.Deletions, stats.Ignores, stats.Total())
+	if err := w.Close(); err != nil {
+		fmt.Printf("%sfailed to write plan to file: %v%s\n", constants.ColorRed, err, constants.ColorReset)
+		return stats, fmt.Errorf("failed to write plan to file: %v", err)
+	}
+	fmt.Printf("%sSuccessfully written plan file to: %s%s\n", constants.ColorGreen, params.OutputFilePath, constants.ColorReset)
+	return stats, nil
+}
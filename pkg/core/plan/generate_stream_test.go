@@ -0,0 +1,116 @@
+package plan_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/core/diff"
+	"github.com/algebananazzzzz/planear/pkg/core/plan"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func streamParams(path string, local []Record, remote map[string]Record) plan.StreamParams[Record] {
+	return plan.StreamParams[Record]{
+		OutputFilePath: path,
+		ValidateRecord: noopValidator,
+		LocalRecords:   diff.SliceIterator(local, extractKey),
+		RemoteRecords:  diff.MapIterator(remote),
+	}
+}
+
+func TestGenerateStream_MatchesGenerate(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	outputPlanFile := filepath.Join(tmpDir, "plan.json")
+
+	local := []Record{
+		{ID: "1", Value: "Updated"},
+		{ID: "2", Value: "Same"},
+		{ID: "4", Value: "New"},
+	}
+	remote := map[string]Record{
+		"1": {ID: "1", Value: "Old"},
+		"2": {ID: "2", Value: "Same"},
+		"3": {ID: "3", Value: "Gone"},
+	}
+
+	stats, err := plan.GenerateStream(streamParams(outputPlanFile, local, remote))
+	require.NoError(t, err)
+	require.Equal(t, diff.StreamStats{Additions: 1, Updates: 1, Deletions: 1}, stats)
+
+	var streamed types.Plan[Record]
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, outputPlanFile), &streamed))
+
+	localMap := map[string]Record{}
+	for _, r := range local {
+		localMap[r.ID] = r
+	}
+	expected, err := diff.ComputePlanDiff(localMap, remote, noopValidator)
+	require.NoError(t, err)
+	require.Equal(t, expected.Additions, streamed.Additions)
+	require.Equal(t, expected.Updates, streamed.Updates)
+	require.Equal(t, expected.Deletions, streamed.Deletions)
+	require.Empty(t, streamed.Ignores)
+
+	// Empty sections are written as arrays, not null.
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(testutils.ReadFile(t, outputPlanFile), &raw))
+	require.JSONEq(t, `[]`, string(raw["ignores"]))
+
+	// Only the plan file is left behind.
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// It is readable like plan files written by Generate.
+	info, err := os.Stat(outputPlanFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestGenerateStream_NoChangesRemovesStalePlan(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	outputPlanFile := filepath.Join(tmpDir, "plan.json")
+	testutils.CreateMockFile(t, tmpDir, "plan.json", []byte(`{}`))
+
+	local := []Record{{ID: "1", Value: "Same"}}
+	remote := map[string]Record{"1": {ID: "1", Value: "Same"}}
+
+	stats, err := plan.GenerateStream(streamParams(outputPlanFile, local, remote))
+	require.NoError(t, err)
+	require.Zero(t, stats.Total())
+	require.False(t, testutils.FileExists(t, outputPlanFile))
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestGenerateStream_UnsortedInputLeavesNoFiles(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+	outputPlanFile := filepath.Join(tmpDir, "plan.json")
+
+	local := []Record{{ID: "2", Value: "B"}, {ID: "1", Value: "A"}}
+
+	_, err := plan.GenerateStream(streamParams(outputPlanFile, local, nil))
+	require.ErrorContains(t, err, "not sorted by key")
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestStreamWriter_CloseTwice(t *testing.T) {
+	tmpDir := testutils.NewTestDir(t)
+
+	w, err := plan.NewStreamWriter[Record](filepath.Join(tmpDir, "plan.json"))
+	require.NoError(t, err)
+	require.NoError(t, w.Add(types.RecordAddition[Record]{Key: "1", New: Record{ID: "1"}}))
+	require.NoError(t, w.Close())
+
+	require.Error(t, w.Close())
+	require.Error(t, w.Add(types.RecordAddition[Record]{Key: "2"}))
+}
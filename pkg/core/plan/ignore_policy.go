@@ -0,0 +1,58 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// IgnoredRecordsError is returned by Generate when GenerateParams.IgnorePolicy
+// rejects a plan because of its ignored records. No plan file is written.
+type IgnoredRecordsError struct {
+	Policy    types.IgnorePolicy
+	Threshold int               // maximum allowed ignores; 0 for IgnoreFailIfAny
+	Keys      []string          // ignored keys in sorted order
+	Reasons   map[string]string // reason per ignored key
+}
+
+func (e *IgnoredRecordsError) Error() string {
+	parts := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		parts[i] = fmt.Sprintf("%s (%s)", key, e.Reasons[key])
+	}
+	limit := "none allowed"
+	if e.Policy == types.IgnoreFailAboveThreshold {
+		limit = fmt.Sprintf("at most %d allowed", e.Threshold)
+	}
+	return fmt.Sprintf("%d record(s) ignored, %s: %s", len(e.Keys), limit, strings.Join(parts, ", "))
+}
+
+// checkIgnores applies policy to the ignored records of plan.
+func checkIgnores[T any](plan types.Plan[T], policy types.IgnorePolicy, threshold int) error {
+	n := len(plan.Ignores)
+	switch policy {
+	case types.IgnoreFailIfAny:
+		if n == 0 {
+			return nil
+		}
+		threshold = 0
+	case types.IgnoreFailAboveThreshold:
+		if n <= threshold {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	err := &IgnoredRecordsError{Policy: policy, Threshold: threshold, Reasons: make(map[string]string, n)}
+	for _, ig := range plan.Ignores {
+		if _, dup := err.Reasons[ig.Key]; !dup {
+			err.Keys = append(err.Keys, ig.Key)
+		}
+		err.Reasons[ig.Key] = ig.Reason
+	}
+	sort.Strings(err.Keys)
+	return err
+}
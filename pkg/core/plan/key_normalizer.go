@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// normalizeKeys re-keys records by normalize(key). It returns the original
+// key of every record whose key changed, and an error when two records end
+// up with the same key; side ("local" or "remote") names them in it.
+func normalizeKeys[T any](records map[string]T, normalize func(string) string, side string) (map[string]T, map[string]string, error) {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]T, len(records))
+	origins := map[string]string{}
+	seen := make(map[string]string, len(records))
+	for _, key := range keys {
+		normalized := normalize(key)
+		if first, dup := seen[normalized]; dup {
+			return nil, nil, fmt.Errorf("%s keys %q and %q both normalize to %q", side, first, key, normalized)
+		}
+		seen[normalized] = key
+		out[normalized] = records[key]
+		if normalized != key {
+			origins[normalized] = key
+		}
+	}
+	return out, origins, nil
+}
+
+// rekey returns m keyed by normalize(key), for per-key data gathered while
+// loading. Collisions cannot occur once normalizeKeys has succeeded.
+func rekey[V any](m map[string]V, normalize func(string) string) map[string]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]V, len(m))
+	for key, v := range m {
+		out[normalize(key)] = v
+	}
+	return out
+}
+
+// withoutKeyChanges drops the changes of key columns that only respell the
+// key, e.g. "alice" to "Alice" under strings.ToLower: a change is dropped
+// when the key extractKey returns for the new record changes with the
+// column, but normalizes to the same key. The new record keeps the remote
+// value of such columns, and updates left without changes are dropped, so
+// matched keys never show up as a permanent update.
+func withoutKeyChanges[T any](plan types.Plan[T], extractKey func(T) string, normalize func(string) string) types.Plan[T] {
+	s, err := schema.Of[T]()
+	if err != nil || len(plan.Updates) == 0 {
+		return plan
+	}
+	updates := plan.Updates[:0]
+	for _, u := range plan.Updates {
+		changes := make([]types.FieldChange, 0, len(u.Changes))
+		for _, change := range u.Changes {
+			f, ok := s.Field(change.Field)
+			if !ok {
+				changes = append(changes, change)
+				continue
+			}
+			respelled := u.New
+			reflect.ValueOf(&respelled).Elem().FieldByIndex(f.Index).Set(reflect.ValueOf(u.Old).FieldByIndex(f.Index))
+			key, remoteKey := extractKey(u.New), extractKey(respelled)
+			if key == remoteKey || normalize(key) != normalize(remoteKey) {
+				changes = append(changes, change)
+				continue
+			}
+			u.New = respelled
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		u.Changes = changes
+		updates = append(updates, u)
+	}
+	plan.Updates = updates
+	return plan
+}
+
+// withOriginalKeys records in plan the original local and remote key of
+// each entry whose key was normalized.
+func withOriginalKeys[T any](plan types.Plan[T], local, remote map[string]string) types.Plan[T] {
+	for i := range plan.Additions {
+		plan.Additions[i].LocalKey = local[plan.Additions[i].Key]
+	}
+	for i := range plan.Updates {
+		plan.Updates[i].LocalKey = local[plan.Updates[i].Key]
+		plan.Updates[i].RemoteKey = remote[plan.Updates[i].Key]
+	}
+	for i := range plan.Deletions {
+		plan.Deletions[i].RemoteKey = remote[plan.Deletions[i].Key]
+	}
+	for i := range plan.Ignores {
+		plan.Ignores[i].LocalKey = local[plan.Ignores[i].Key]
+	}
+	return plan
+}
+
+// normalizedDependsOn normalizes the keys dependsOn returns, so they match
+// the normalized keys of the plan.
+func normalizedDependsOn[T any](dependsOn func(T) []string, normalize func(string) string) func(T) []string {
+	return func(rec T) []string {
+		deps := dependsOn(rec)
+		out := make([]string, len(deps))
+		for i, dep := range deps {
+			out[i] = normalize(dep)
+		}
+		return out
+	}
+}
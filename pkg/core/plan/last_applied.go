@@ -0,0 +1,70 @@
+package plan
+
+import (
+	"github.com/algebananazzzzz/planear/pkg/core/diff"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/algebananazzzzz/planear/pkg/utils"
+)
+
+// loadLastApplied reads the last-applied snapshot at path; a missing file
+// yields no records. The snapshot holds records as stored in the plan file,
+// so sensitive columns and interpolated cells (templates) are redacted or
+// unresolved there. Those columns are replaced by their remote value, which
+// makes the three-way diff treat any difference as a change from the CSV.
+func loadLastApplied[T any](path string, remote map[string]T, sensitive []string, templates map[string]map[string]string) (map[string]T, error) {
+	var base map[string]T
+	if err := utils.ParseJSONFile(path, "last-applied snapshot", &base); err != nil {
+		return nil, err
+	}
+	if len(base) == 0 || (len(sensitive) == 0 && len(templates) == 0) {
+		return base, nil
+	}
+
+	unknown := make(map[string][]string, len(base))
+	for key := range base {
+		columns := append([]string(nil), sensitive...)
+		for column := range templates[key] {
+			columns = append(columns, column)
+		}
+		if len(columns) > 0 {
+			unknown[key] = columns
+		}
+	}
+	return diff.FillUnset(base, remote, unknown)
+}
+
+// inSyncRecords returns the local records plan needs no operation for: those
+// with a remote record that are neither updated nor ignored. Interpolated
+// cells get their templates back, as in the plan file.
+func inSyncRecords[T any](plan types.Plan[T], local, remote map[string]T, templates map[string]map[string]string) (map[string]T, error) {
+	planned := make(map[string]bool, len(plan.Updates)+len(plan.Ignores))
+	for _, u := range plan.Updates {
+		planned[u.Key] = true
+	}
+	for _, ig := range plan.Ignores {
+		planned[ig.Key] = true
+	}
+
+	inSync := map[string]T{}
+	for key, rec := range local {
+		if _, ok := remote[key]; !ok || planned[key] {
+			continue
+		}
+		columns := make([]string, 0, len(templates[key]))
+		for column := range templates[key] {
+			columns = append(columns, column)
+		}
+		rec, err := schema.ReplaceText(rec, columns, func(column, _ string) (string, error) {
+			return templates[key][column], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		inSync[key] = rec
+	}
+	if len(inSync) == 0 {
+		return nil, nil
+	}
+	return inSync, nil
+}
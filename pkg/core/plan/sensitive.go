@@ -0,0 +1,282 @@
+package plan
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/formatters"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// sensitiveColumns lists, for each key in the plan with interpolated cells,
+// the columns holding them in sorted order.
+func sensitiveColumns[T any](plan types.Plan[T], templates map[string]map[string]string) map[string][]string {
+	sensitive := map[string][]string{}
+	mark := func(key string) {
+		t, ok := templates[key]
+		if !ok {
+			return
+		}
+		columns := make([]string, 0, len(t))
+		for column := range t {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		sensitive[key] = columns
+	}
+	for _, a := range plan.Additions {
+		mark(a.Key)
+	}
+	for _, u := range plan.Updates {
+		mark(u.Key)
+	}
+	for _, ig := range plan.Ignores {
+		mark(ig.Key)
+	}
+	if len(sensitive) == 0 {
+		return nil
+	}
+	return sensitive
+}
+
+// withTemplates returns the copy of plan written to the plan file: each
+// interpolated cell holds its `${...}` template instead of the resolved
+// value, which apply.Run resolves again. Remote values of those columns and
+// the old side of their field changes are replaced by formatters.Redacted.
+func withTemplates[T any](plan types.Plan[T], templates map[string]map[string]string) (types.Plan[T], error) {
+	if len(plan.Sensitive) == 0 {
+		return plan, nil
+	}
+
+	restore := func(key string, rec T) (T, error) {
+		return schema.ReplaceText(rec, plan.Sensitive[key], func(column, _ string) (string, error) {
+			return templates[key][column], nil
+		})
+	}
+	redact := func(key string, rec T) (T, error) {
+		return schema.ReplaceText(rec, plan.Sensitive[key], func(string, string) (string, error) {
+			return formatters.Redacted, nil
+		})
+	}
+
+	var err error
+	out := plan
+	out.Additions = slices.Clone(plan.Additions)
+	for i, a := range out.Additions {
+		if out.Additions[i].New, err = restore(a.Key, a.New); err != nil {
+			return out, err
+		}
+	}
+	out.Updates = slices.Clone(plan.Updates)
+	for i, u := range out.Updates {
+		if out.Updates[i].New, err = restore(u.Key, u.New); err != nil {
+			return out, err
+		}
+		if out.Updates[i].Old, err = redact(u.Key, u.Old); err != nil {
+			return out, err
+		}
+		if u.Local != nil {
+			local, err := restore(u.Key, *u.Local)
+			if err != nil {
+				return out, err
+			}
+			out.Updates[i].Local = &local
+		}
+		changes := slices.Clone(u.Changes)
+		for j, c := range changes {
+			if t, ok := templates[u.Key][c.Field]; ok {
+				changes[j].OldValue = formatters.Redacted
+				changes[j].NewValue = t
+			}
+		}
+		out.Updates[i].Changes = changes
+	}
+	out.Ignores = slices.Clone(plan.Ignores)
+	for i, ig := range out.Ignores {
+		if out.Ignores[i].Record, err = restore(ig.Key, ig.Record); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// sensitiveFieldColumns returns the columns of T tagged `sensitive` followed
+// by the extra names, which must be managed columns of T.
+func sensitiveFieldColumns[T any](extra []string) ([]string, error) {
+	s, err := schema.Of[T]()
+	if err != nil {
+		if len(extra) > 0 {
+			return nil, fmt.Errorf("SensitiveFields: %w", err)
+		}
+		return nil, nil
+	}
+	columns := s.SensitiveColumns()
+	for _, column := range extra {
+		if _, ok := s.Field(column); !ok {
+			return nil, fmt.Errorf("SensitiveFields: %q is not a column of %s", column, s.Type)
+		}
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// digestChanges replaces the field changes of plan.SensitiveColumns with a
+// single change per column holding the digests of the old and new field
+// values under digester. Columns named in SensitiveFields still carry
+// values, and tagged ones carry digests that are only valid in this
+// process (see schema.Digest).
+func digestChanges[T any](plan types.Plan[T], digester schema.Digester) (types.Plan[T], error) {
+	if len(plan.Updates) == 0 {
+		return plan, nil
+	}
+	s, err := schema.Of[T]()
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Updates = slices.Clone(plan.Updates)
+	for i, u := range plan.Updates {
+		oldV, newV := reflect.ValueOf(u.Old), reflect.ValueOf(u.New)
+		var changes []types.FieldChange
+		done := map[string]bool{}
+		for _, c := range u.Changes {
+			column, ok := sensitiveColumnOf(c.Field, plan.SensitiveColumns)
+			if !ok {
+				changes = append(changes, c)
+				continue
+			}
+			if done[column] {
+				continue
+			}
+			done[column] = true
+			f, _ := s.Field(column)
+			changes = append(changes, types.FieldChange{
+				Field:    column,
+				OldValue: digester.Digest(oldV.FieldByIndex(f.Index).Interface()),
+				NewValue: digester.Digest(newV.FieldByIndex(f.Index).Interface()),
+			})
+		}
+		plan.Updates[i].Changes = changes
+	}
+	return plan, nil
+}
+
+// sensitiveColumnOf returns the column among columns that field, a
+// FieldChange name such as "token" or "roles[1]", belongs to.
+func sensitiveColumnOf(field string, columns []string) (string, bool) {
+	for _, column := range columns {
+		if field == column || strings.HasPrefix(field, column+"[") {
+			return column, true
+		}
+	}
+	return "", false
+}
+
+// unsetSensitive lists, per key of an update, the SensitiveColumns among the
+// columns the CSV left unset, in sorted order.
+func unsetSensitive[T any](plan types.Plan[T], unset map[string][]string) map[string][]string {
+	out := map[string][]string{}
+	for _, u := range plan.Updates {
+		var columns []string
+		for _, column := range unset[u.Key] {
+			if slices.Contains(plan.SensitiveColumns, column) {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) > 0 {
+			sort.Strings(columns)
+			out[u.Key] = columns
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// withDigests returns the copy of plan written to the plan file when it has
+// SensitiveColumns: their values are redacted in every record, and the
+// digest of each planned value, as read from the CSV into local (before
+// normalization), is kept in Plan.Digests so apply.Run can check the values
+// it reloads from the CSV, keyed by digester. Columns in plan.Unset are digested from remote,
+// where their planned values come from. Columns interpolated for a
+// key are skipped; the plan file already holds their `${...}` templates.
+func withDigests[T any](plan types.Plan[T], digester schema.Digester, local, remote map[string]T) (types.Plan[T], error) {
+	if len(plan.SensitiveColumns) == 0 {
+		return plan, nil
+	}
+	s, err := schema.Of[T]()
+	if err != nil {
+		return plan, err
+	}
+
+	columnsOf := func(key string) []string {
+		var columns []string
+		for _, column := range plan.SensitiveColumns {
+			if !slices.Contains(plan.Sensitive[key], column) {
+				columns = append(columns, column)
+			}
+		}
+		return columns
+	}
+	digests := map[string]map[string]string{}
+	digest := func(key string, columns []string) {
+		if len(columns) == 0 {
+			return
+		}
+		l, r := reflect.ValueOf(local[key]), reflect.ValueOf(remote[key])
+		d := make(map[string]string, len(columns))
+		for _, column := range columns {
+			f, _ := s.Field(column)
+			v := l
+			if slices.Contains(plan.Unset[key], column) {
+				v = r
+			}
+			d[column] = digester.Digest(v.FieldByIndex(f.Index).Interface())
+		}
+		digests[key] = d
+	}
+
+	out := plan
+	out.Additions = slices.Clone(plan.Additions)
+	for i, a := range out.Additions {
+		columns := columnsOf(a.Key)
+		digest(a.Key, columns)
+		out.Additions[i].New = formatters.RedactRecord(a.New, columns)
+	}
+	out.Updates = slices.Clone(plan.Updates)
+	for i, u := range out.Updates {
+		columns := columnsOf(u.Key)
+		digest(u.Key, columns)
+		out.Updates[i].Old = formatters.RedactRecord(u.Old, columns)
+		out.Updates[i].New = formatters.RedactRecord(u.New, columns)
+		if u.Local != nil {
+			local := formatters.RedactRecord(*u.Local, columns)
+			out.Updates[i].Local = &local
+		}
+	}
+	out.Deletions = slices.Clone(plan.Deletions)
+	for i, d := range out.Deletions {
+		out.Deletions[i].Old = formatters.RedactRecord(d.Old, plan.SensitiveColumns)
+	}
+	out.Ignores = slices.Clone(plan.Ignores)
+	for i, ig := range out.Ignores {
+		out.Ignores[i].Record = formatters.RedactRecord(ig.Record, columnsOf(ig.Key))
+	}
+	if plan.InSync != nil {
+		out.InSync = make(map[string]T, len(plan.InSync))
+		for key, rec := range plan.InSync {
+			out.InSync[key] = formatters.RedactRecord(rec, columnsOf(key))
+		}
+	}
+	if len(digests) > 0 {
+		out.Digests = digests
+	}
+	return out, nil
+}
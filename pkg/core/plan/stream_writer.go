@@ -0,0 +1,156 @@
+package plan
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// planSections are the Plan fields a StreamWriter fills, in file order.
+var planSections = [...]string{"additions", "updates", "deletions", "ignores"}
+
+// StreamWriter writes a plan file entry by entry as diff.StreamPlanDiff
+// produces them; it implements diff.Sink. Each section is spooled to a
+// temporary file next to the plan file and Close assembles them, so memory
+// use does not depend on the number of entries. The result is a regular
+// plan file that apply.Run reads like any other.
+type StreamWriter[T any] struct {
+	path   string
+	spools [len(planSections)]*spool
+}
+
+type spool struct {
+	file *os.File
+	w    *bufio.Writer
+	n    int
+}
+
+// NewStreamWriter creates the spool files for a plan file at path, creating
+// its directory if needed. Call Close to write the plan file, or Abort to
+// discard it.
+func NewStreamWriter[T any](path string) (*StreamWriter[T], error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("create directory %s: %v", dir, err)
+	}
+	w := &StreamWriter[T]{path: path}
+	for i, section := range planSections {
+		f, err := os.CreateTemp(dir, "."+filepath.Base(path)+"."+section+"-*")
+		if err != nil {
+			w.Abort()
+			return nil, fmt.Errorf("create spool file: %v", err)
+		}
+		w.spools[i] = &spool{file: f, w: bufio.NewWriter(f)}
+	}
+	return w, nil
+}
+
+// Add spools an addition.
+func (w *StreamWriter[T]) Add(a types.RecordAddition[T]) error { return w.write(0, a) }
+
+// Update spools an update.
+func (w *StreamWriter[T]) Update(u types.RecordUpdate[T]) error { return w.write(1, u) }
+
+// Delete spools a deletion.
+func (w *StreamWriter[T]) Delete(d types.RecordDeletion[T]) error { return w.write(2, d) }
+
+// Ignore spools an ignored record.
+func (w *StreamWriter[T]) Ignore(ig types.RecordIgnored[T]) error { return w.write(3, ig) }
+
+func (w *StreamWriter[T]) write(section int, entry any) error {
+	if w.spools[section] == nil {
+		return fmt.Errorf("stream writer for %s is already closed", w.path)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s entry: %w", planSections[section], err)
+	}
+	s := w.spools[section]
+	if s.n > 0 {
+		s.w.WriteString(",\n")
+	}
+	s.w.WriteString("    ")
+	if _, err := s.w.Write(data); err != nil {
+		return fmt.Errorf("failed to spool %s entry: %w", planSections[section], err)
+	}
+	s.n++
+	return nil
+}
+
+// Close assembles the spooled sections into the plan file, replacing it
+// atomically, and removes the spool files.
+func (w *StreamWriter[T]) Close() error {
+	if w.spools[0] == nil {
+		return fmt.Errorf("stream writer for %s is already closed", w.path)
+	}
+	defer w.Abort()
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), "."+filepath.Base(w.path)+"-*")
+	if err != nil {
+		return fmt.Errorf("create plan file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	out := bufio.NewWriter(tmp)
+	out.WriteString("{\n")
+	for i, s := range w.spools {
+		if err := s.w.Flush(); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to spool %s: %w", planSections[i], err)
+		}
+		fmt.Fprintf(out, "  %q: [", planSections[i])
+		if s.n > 0 {
+			out.WriteString("\n")
+			if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to read spooled %s: %w", planSections[i], err)
+			}
+			if _, err := io.Copy(out, s.file); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to copy spooled %s: %w", planSections[i], err)
+			}
+			out.WriteString("\n  ")
+		}
+		out.WriteString("]")
+		if i < len(w.spools)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("}\n")
+	if err := out.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write plan file: %v", err)
+	}
+	// CreateTemp makes the file 0600; plan files are 0644 like those
+	// utils.WriteJSONFile writes.
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write plan file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write plan file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return fmt.Errorf("write plan file: %v", err)
+	}
+	return nil
+}
+
+// Abort removes the spool files without writing the plan file. It is safe
+// to call more than once, and after Close.
+func (w *StreamWriter[T]) Abort() {
+	for i, s := range w.spools {
+		if s == nil {
+			continue
+		}
+		s.file.Close()
+		os.Remove(s.file.Name())
+		w.spools[i] = nil
+	}
+}
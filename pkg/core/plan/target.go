@@ -0,0 +1,127 @@
+package plan
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// Target restricts a plan to selected records, like `terraform plan
+// -target`. A record is targeted when its key is listed in Keys, matches one
+// of Globs (path.Match patterns such as "team-*"), or satisfies Match. The
+// zero value targets every record.
+type Target[T any] struct {
+	Keys  []string
+	Globs []string
+
+	// Match is called with the local and remote record of the key; either
+	// is nil when the key exists only on the other side.
+	Match func(key string, local, remote *T) bool
+
+	// NoDependencies disables pulling in the operations that targeted
+	// operations depend on (see GenerateParams.DependsOn). Applying such a
+	// plan can fail on references to records it leaves out.
+	NoDependencies bool
+}
+
+// IsZero reports whether t selects nothing, i.e. targets every record.
+func (t Target[T]) IsZero() bool {
+	return len(t.Keys) == 0 && len(t.Globs) == 0 && t.Match == nil
+}
+
+func (t Target[T]) matches(key string, local, remote map[string]T) bool {
+	if slices.Contains(t.Keys, key) {
+		return true
+	}
+	for _, pattern := range t.Globs {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	if t.Match == nil {
+		return false
+	}
+	var l, r *T
+	if rec, ok := local[key]; ok {
+		l = &rec
+	}
+	if rec, ok := remote[key]; ok {
+		r = &rec
+	}
+	return t.Match(key, l, r)
+}
+
+// applyTarget keeps the operations, ignores and conflicts of plan whose key is
+// targeted and, unless target.NoDependencies is set or dependsOn is nil, the
+// operations they transitively depend on.
+func applyTarget[T any](plan types.Plan[T], target Target[T], local, remote map[string]T, dependsOn func(T) []string) (types.Plan[T], error) {
+	for _, pattern := range target.Globs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return plan, fmt.Errorf("invalid target pattern %q: %w", pattern, err)
+		}
+	}
+
+	selected := map[string]bool{}
+	var queue []string
+	selectOp := func(kind types.LayerOpKind, key string) {
+		if target.matches(key, local, remote) {
+			id := opNodeID(kind, key)
+			selected[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, a := range plan.Additions {
+		selectOp(types.LayerOpAdd, a.Key)
+	}
+	for _, u := range plan.Updates {
+		selectOp(types.LayerOpUpdate, u.Key)
+	}
+	for _, d := range plan.Deletions {
+		selectOp(types.LayerOpDelete, d.Key)
+	}
+
+	if dependsOn != nil && !target.NoDependencies {
+		g := buildOpGraph(plan, dependsOn)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, dep := range g.edges[id] {
+				if !selected[dep] {
+					selected[dep] = true
+					queue = append(queue, dep)
+				}
+			}
+		}
+	}
+
+	out := plan
+	out.Additions, out.Updates, out.Deletions, out.Ignores, out.Conflicts = nil, nil, nil, nil, nil
+	for _, a := range plan.Additions {
+		if selected[opNodeID(types.LayerOpAdd, a.Key)] {
+			out.Additions = append(out.Additions, a)
+		}
+	}
+	for _, u := range plan.Updates {
+		if selected[opNodeID(types.LayerOpUpdate, u.Key)] {
+			out.Updates = append(out.Updates, u)
+		}
+	}
+	for _, d := range plan.Deletions {
+		if selected[opNodeID(types.LayerOpDelete, d.Key)] {
+			out.Deletions = append(out.Deletions, d)
+		}
+	}
+	for _, ig := range plan.Ignores {
+		if target.matches(ig.Key, local, remote) {
+			out.Ignores = append(out.Ignores, ig)
+		}
+	}
+	for _, c := range plan.Conflicts {
+		if target.matches(c.Key, local, remote) {
+			out.Conflicts = append(out.Conflicts, c)
+		}
+	}
+	return out, nil
+}
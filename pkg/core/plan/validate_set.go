@@ -0,0 +1,82 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// validateSet calls validate (GenerateParams.ValidateSet) once with the
+// local records that passed ValidateRecord, i.e. those not already in
+// plan.Ignores. A returned key that is not such a record is an error. The
+// keys it rejects are handled by policy: by default they are dropped from
+// Additions and Updates and added to Ignores with their error as the
+// reason; with SetValidationFail the plan is rejected with an error listing
+// every key and reason in key order.
+func validateSet[T any](
+	plan types.Plan[T],
+	localRecords map[string]T,
+	validate func(map[string]T) map[string]error,
+	policy types.SetValidationPolicy,
+) (types.Plan[T], error) {
+	valid := make(map[string]T, len(localRecords))
+	for key, rec := range localRecords {
+		valid[key] = rec
+	}
+	for _, ig := range plan.Ignores {
+		delete(valid, ig.Key)
+	}
+
+	rejected := map[string]error{}
+	for key, err := range validate(valid) {
+		if err == nil {
+			continue
+		}
+		if _, ok := valid[key]; !ok {
+			return plan, fmt.Errorf("ValidateSet returned key %q, which is not a valid local record", key)
+		}
+		rejected[key] = err
+	}
+	if len(rejected) == 0 {
+		return plan, nil
+	}
+
+	keys := make([]string, 0, len(rejected))
+	for key := range rejected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if policy == types.SetValidationFail {
+		reasons := make([]string, len(keys))
+		for i, key := range keys {
+			reasons[i] = fmt.Sprintf("%s: %v", key, rejected[key])
+		}
+		return plan, fmt.Errorf("ValidateSet rejected %d record(s): %s", len(keys), strings.Join(reasons, "; "))
+	}
+
+	var additions []types.RecordAddition[T]
+	for _, a := range plan.Additions {
+		if _, ok := rejected[a.Key]; !ok {
+			additions = append(additions, a)
+		}
+	}
+	var updates []types.RecordUpdate[T]
+	for _, u := range plan.Updates {
+		if _, ok := rejected[u.Key]; !ok {
+			updates = append(updates, u)
+		}
+	}
+	plan.Additions = additions
+	plan.Updates = updates
+	for _, key := range keys {
+		plan.Ignores = append(plan.Ignores, types.RecordIgnored[T]{
+			Key:    key,
+			Record: localRecords[key],
+			Reason: rejected[key].Error(),
+		})
+	}
+	return plan, nil
+}
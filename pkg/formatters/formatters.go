@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/algebananazzzzz/planear/pkg/constants"
+	"github.com/algebananazzzzz/planear/pkg/schema"
 	"github.com/algebananazzzzz/planear/pkg/types"
 )
 
@@ -36,6 +37,28 @@ func formatValue(v any) any {
 	return v
 }
 
+// FormatRecord renders every column managed for T as "column: value" pairs,
+// in struct field order, using the cached schema of T. It can be passed as
+// the formatRecord callback when no domain-specific format is needed.
+// Non-struct records are rendered with fmt.Sprint.
+func FormatRecord[T any](record T) string {
+	v := reflect.ValueOf(record)
+	if !v.IsValid() || v.Kind() != reflect.Struct {
+		return fmt.Sprint(record)
+	}
+	s, err := schema.For(v.Type())
+	if err != nil {
+		return fmt.Sprint(record)
+	}
+
+	parts := make([]string, len(s.Fields))
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		parts[i] = fmt.Sprintf("%s: %v", f.Column, formatValue(v.FieldByIndex(f.Index).Interface()))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // FormatAdd returns a formatted string representing a record addition.
 func FormatAdd[T any](record types.RecordAddition[T], formatRecord func(T) string) string {
 	return fmt.Sprintf("    %s+%s %s\n",
@@ -46,11 +69,15 @@ func FormatAdd[T any](record types.RecordAddition[T], formatRecord func(T) strin
 }
 
 // formatUpdate returns a formatted string representing the changes in a record update.
+// Changes of sensitive fields, which hold digests, are shown as Redacted.
 func FormatUpdate[T any](record types.RecordUpdate[T], formatKey func(string) string) string {
 	var parts []string
 	for _, change := range record.Changes {
 		oldVal := formatValue(change.OldValue)
 		newVal := formatValue(change.NewValue)
+		if isDigest(change.OldValue) && isDigest(change.NewValue) {
+			oldVal, newVal = Redacted, Redacted
+		}
 		parts = append(parts, fmt.Sprintf("%s: %v => %v", change.Field, oldVal, newVal))
 	}
 	updates := strings.Join(parts, ", ")
@@ -80,3 +107,26 @@ func formatIgnore[T any](record types.RecordIgnored[T], formatRecord func(T) str
 		formatRecord(record.Record),
 	)
 }
+
+// formatConflict returns a formatted string for the conflicting fields of a
+// record and the side the plan keeps.
+func formatConflict(record types.RecordConflict, formatKey func(string) string) string {
+	kept := "remote"
+	if record.Policy == types.ConflictLocalWins {
+		kept = "local"
+	}
+	var parts []string
+	for _, f := range record.Fields {
+		base, local, remote := formatValue(f.Base), formatValue(f.Local), formatValue(f.Remote)
+		if isDigest(f.Local) {
+			base, local, remote = Redacted, Redacted, Redacted
+		}
+		parts = append(parts, fmt.Sprintf("%s: %v => local %v, remote %v", f.Field, base, local, remote))
+	}
+	return fmt.Sprintf("    %s!%s %s, %s (keeping %s)\n",
+		constants.ColorRed,
+		constants.ColorReset,
+		formatKey(record.Key),
+		strings.Join(parts, ", "),
+		kept)
+}
@@ -100,3 +100,21 @@ func TestFormatIgnore(t *testing.T) {
 	expected := "    \033[35m? duplicate:\033[0m 3:Diana\n"
 	assert.Equal(t, expected, formatIgnore(rec, formatMockRecord))
 }
+
+func TestFormatRecord(t *testing.T) {
+	type address struct {
+		City string `csv:"city"`
+	}
+	type user struct {
+		ID     string  `csv:"id"`
+		Score  *int    `csv:"score"`
+		Addr   address `csv:"addr_,inline"`
+		Secret string
+	}
+
+	score := 7
+	require.Equal(t, "id: u1, score: 7, addr_city: Paris",
+		FormatRecord(user{ID: "u1", Score: &score, Addr: address{City: "Paris"}, Secret: "x"}))
+	require.Equal(t, "id: u2, score: null, addr_city: ", FormatRecord(user{ID: "u2"}))
+	require.Equal(t, "plain", FormatRecord("plain"))
+}
@@ -7,12 +7,15 @@ import (
 	"github.com/algebananazzzzz/planear/pkg/types"
 )
 
+// FormatPlan renders the plan legend, details and summary. Sensitive
+// columns (see RedactPlan) are shown as Redacted.
 func FormatPlan[T any](
 	plan types.Plan[T],
 	formatRecord func(T) string,
 	formatKey func(string) string,
 ) string {
 	var b strings.Builder
+	plan = RedactPlan(plan)
 
 	b.WriteString(formatLegend())
 
@@ -62,6 +62,13 @@ func formatPlanDetails[T any](
 		}
 	}
 
+	if len(plan.Conflicts) > 0 {
+		fmt.Fprintf(&b, "\n# %d row(s) were also changed remotely since the last apply\n", len(plan.Conflicts))
+		for _, c := range plan.Conflicts {
+			fmt.Fprint(&b, formatConflict(c, formatKey))
+		}
+	}
+
 	return b.String(), PlanSummary{
 		Addition: len(plan.Additions),
 		Update:   len(plan.Updates),
@@ -64,3 +64,18 @@ func TestFormatPlanDetails(t *testing.T) {
 		assert.Contains(t, output, line)
 	}
 }
+
+func TestFormatPlanDetails_Conflicts(t *testing.T) {
+	plan := types.Plan[MockRecord]{
+		Conflicts: []types.RecordConflict{
+			{Key: "1", Fields: []types.FieldConflict{{Field: "Name", Base: "Al", Local: "Alice", Remote: "Alicia"}}},
+			{Key: "2", Fields: []types.FieldConflict{{Field: "Name", Base: "B", Local: "Bo", Remote: "Bob"}}, Policy: types.ConflictLocalWins},
+		},
+	}
+
+	output, summary := formatters.TestableFormatPlanDetails(plan, func(r MockRecord) string { return r.ID }, func(k string) string { return k })
+	assert.Equal(t, formatters.PlanSummary{}, summary)
+	assert.Contains(t, output, "# 2 row(s) were also changed remotely since the last apply")
+	assert.Contains(t, output, "1, Name: Al => local Alice, remote Alicia (keeping remote)")
+	assert.Contains(t, output, "2, Name: B => local Bo, remote Bob (keeping local)")
+}
@@ -0,0 +1,130 @@
+package formatters
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// Redacted is shown in place of sensitive values.
+const Redacted = "(sensitive)"
+
+// RedactPlan returns a copy of plan in which the sensitive columns of each
+// record — plan.SensitiveColumns plus plan.Sensitive[key] — are hidden:
+// string fields read Redacted, other fields are zeroed, and field changes
+// report Redacted as both values. Deletions only carry remote values, and
+// in-sync records hold templates rather than interpolated values, so they
+// are redacted for plan.SensitiveColumns alone.
+func RedactPlan[T any](plan types.Plan[T]) types.Plan[T] {
+	if len(plan.Sensitive) == 0 && len(plan.SensitiveColumns) == 0 {
+		return plan
+	}
+	columnsOf := func(key string) []string {
+		if len(plan.SensitiveColumns) == 0 {
+			return plan.Sensitive[key]
+		}
+		return append(slices.Clone(plan.SensitiveColumns), plan.Sensitive[key]...)
+	}
+
+	out := plan
+	out.Additions = slices.Clone(plan.Additions)
+	for i, a := range out.Additions {
+		out.Additions[i].New = RedactRecord(a.New, columnsOf(a.Key))
+	}
+	out.Updates = slices.Clone(plan.Updates)
+	for i, u := range out.Updates {
+		columns := columnsOf(u.Key)
+		out.Updates[i].Old = RedactRecord(u.Old, columns)
+		out.Updates[i].New = RedactRecord(u.New, columns)
+		if u.Local != nil {
+			local := RedactRecord(*u.Local, columns)
+			out.Updates[i].Local = &local
+		}
+		out.Updates[i].Changes = RedactChanges(u.Changes, columns)
+	}
+	out.Deletions = slices.Clone(plan.Deletions)
+	for i, d := range out.Deletions {
+		out.Deletions[i].Old = RedactRecord(d.Old, plan.SensitiveColumns)
+	}
+	out.Ignores = slices.Clone(plan.Ignores)
+	for i, ig := range out.Ignores {
+		out.Ignores[i].Record = RedactRecord(ig.Record, columnsOf(ig.Key))
+	}
+	if plan.InSync != nil {
+		out.InSync = make(map[string]T, len(plan.InSync))
+		for key, rec := range plan.InSync {
+			out.InSync[key] = RedactRecord(rec, plan.SensitiveColumns)
+		}
+	}
+	return out
+}
+
+// RedactChanges returns a copy of changes with the values of the listed
+// columns (including their "<column>[...]" elements) replaced by Redacted.
+func RedactChanges(changes []types.FieldChange, columns []string) []types.FieldChange {
+	if len(columns) == 0 {
+		return changes
+	}
+	out := slices.Clone(changes)
+	for i, c := range out {
+		if isSensitiveField(c.Field, columns) {
+			out[i].OldValue = Redacted
+			out[i].NewValue = Redacted
+		}
+	}
+	return out
+}
+
+// isDigest reports whether v is a schema.Digest, as recorded for the
+// changes of a sensitive field.
+func isDigest(v any) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, schema.DigestPrefix)
+}
+
+func isSensitiveField(field string, columns []string) bool {
+	for _, column := range columns {
+		if field == column || strings.HasPrefix(field, column+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRecord returns a copy of rec with the listed columns hidden: string
+// fields read Redacted and other fields are zeroed. Unknown columns and
+// non-struct records are left as-is.
+func RedactRecord[T any](rec T, columns []string) T {
+	if len(columns) == 0 {
+		return rec
+	}
+	v := reflect.ValueOf(&rec).Elem()
+	if v.Kind() != reflect.Struct {
+		return rec
+	}
+	s, err := schema.For(v.Type())
+	if err != nil {
+		return rec
+	}
+
+	var text []string
+	for _, column := range columns {
+		f, ok := s.Field(column)
+		if !ok {
+			continue
+		}
+		if f.IsText() {
+			text = append(text, column)
+		} else {
+			field := v.FieldByIndex(f.Index)
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	rec, _ = schema.ReplaceText(rec, text, func(string, string) (string, error) {
+		return Redacted, nil
+	})
+	return rec
+}
@@ -0,0 +1,96 @@
+package formatters
+
+import (
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type secretRecord struct {
+	ID    string `csv:"id"`
+	Token string `csv:"token"`
+	Quota int    `csv:"quota"`
+}
+
+func TestRedactPlan(t *testing.T) {
+	plan := types.Plan[secretRecord]{
+		Additions: []types.RecordAddition[secretRecord]{
+			{Key: "1", New: secretRecord{ID: "1", Token: "s3cr3t", Quota: 5}},
+			{Key: "2", New: secretRecord{ID: "2", Token: "public"}},
+		},
+		Updates: []types.RecordUpdate[secretRecord]{{
+			Key: "3",
+			Old: secretRecord{ID: "3", Token: "old", Quota: 1},
+			New: secretRecord{ID: "3", Token: "new", Quota: 2},
+			Changes: []types.FieldChange{
+				{Field: "token", OldValue: "old", NewValue: "new"},
+				{Field: "quota", OldValue: 1, NewValue: 2},
+			},
+		}},
+		Ignores: []types.RecordIgnored[secretRecord]{
+			{Key: "4", Record: secretRecord{ID: "4", Token: "bad"}, Reason: "invalid"},
+		},
+		Sensitive: map[string][]string{"1": {"token", "quota"}, "3": {"token"}, "4": {"token"}},
+	}
+
+	redacted := RedactPlan(plan)
+	require.Equal(t, secretRecord{ID: "1", Token: Redacted}, redacted.Additions[0].New)
+	require.Equal(t, "public", redacted.Additions[1].New.Token)
+	require.Equal(t, Redacted, redacted.Updates[0].Old.Token)
+	require.Equal(t, Redacted, redacted.Updates[0].New.Token)
+	require.Equal(t, []types.FieldChange{
+		{Field: "token", OldValue: Redacted, NewValue: Redacted},
+		{Field: "quota", OldValue: 1, NewValue: 2},
+	}, redacted.Updates[0].Changes)
+	require.Equal(t, Redacted, redacted.Ignores[0].Record.Token)
+
+	// The input plan is left untouched.
+	require.Equal(t, "s3cr3t", plan.Additions[0].New.Token)
+	require.Equal(t, "new", plan.Updates[0].Changes[0].NewValue)
+}
+
+func TestFormatPlan_RedactsSensitiveColumns(t *testing.T) {
+	plan := types.Plan[secretRecord]{
+		Additions: []types.RecordAddition[secretRecord]{
+			{Key: "1", New: secretRecord{ID: "1", Token: "s3cr3t"}},
+		},
+		Sensitive: map[string][]string{"1": {"token"}},
+	}
+
+	out := FormatPlan(plan, FormatRecord[secretRecord], func(k string) string { return k })
+	require.Contains(t, out, "token: (sensitive)")
+	require.NotContains(t, out, "s3cr3t")
+}
+
+func TestRedactPlan_SensitiveColumns(t *testing.T) {
+	plan := types.Plan[secretRecord]{
+		Additions: []types.RecordAddition[secretRecord]{{Key: "1", New: secretRecord{ID: "1", Token: "a"}}},
+		Deletions: []types.RecordDeletion[secretRecord]{{Key: "2", Old: secretRecord{ID: "2", Token: "b", Quota: 3}}},
+		Ignores:   []types.RecordIgnored[secretRecord]{{Key: "3", Record: secretRecord{ID: "3", Token: "c", Quota: 4}}},
+		Sensitive: map[string][]string{"3": {"quota"}},
+
+		SensitiveColumns: []string{"token"},
+	}
+
+	redacted := RedactPlan(plan)
+	require.Equal(t, secretRecord{ID: "1", Token: Redacted}, redacted.Additions[0].New)
+	require.Equal(t, secretRecord{ID: "2", Token: Redacted, Quota: 3}, redacted.Deletions[0].Old)
+	require.Equal(t, secretRecord{ID: "3", Token: Redacted}, redacted.Ignores[0].Record)
+}
+
+func TestFormatUpdate_DigestsShownAsSensitive(t *testing.T) {
+	update := types.RecordUpdate[secretRecord]{
+		Key: "1",
+		Changes: []types.FieldChange{
+			{Field: "token", OldValue: schema.Digest("old"), NewValue: schema.Digest("new")},
+			{Field: "quota", OldValue: 1, NewValue: 2},
+		},
+	}
+
+	out := FormatUpdate(update, func(k string) string { return k })
+	require.Contains(t, out, "token: (sensitive) => (sensitive)")
+	require.Contains(t, out, "quota: 1 => 2")
+	require.NotContains(t, out, "sha256:")
+}
@@ -0,0 +1,328 @@
+package input
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default limits of ArchiveOptions.
+const (
+	DefaultArchiveMaxSize     = 1 << 30   // 1 GiB
+	DefaultArchiveMaxFileSize = 256 << 20 // 256 MiB
+)
+
+// ArchiveOptions limits how much of an archive is read into memory, so a
+// corrupt or malicious archive (e.g. a gzip bomb) fails with an error
+// instead of exhausting memory. Zero fields use the defaults.
+type ArchiveOptions struct {
+	MaxSize     int64 // total size of the files, decompressed; default DefaultArchiveMaxSize
+	MaxFileSize int64 // size of a single file, decompressed; default DefaultArchiveMaxFileSize
+}
+
+func (o ArchiveOptions) withDefaults() ArchiveOptions {
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultArchiveMaxSize
+	}
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = DefaultArchiveMaxFileSize
+	}
+	return o
+}
+
+// OpenArchive opens a ".tar", ".tar.gz" (or ".tgz") or ".zip" archive as a
+// read-only fs.FS, for use as DecodeOptions.FS or GenerateParams.FS. The
+// archive is read into memory and the file is closed before returning.
+// Entry names must be unique, and no file may share its path with a
+// directory.
+//
+// Example usage:
+//
+//	fsys, err := input.OpenArchive("desired-state.tar.gz")
+//	if err != nil {
+//	    // handle error
+//	}
+//	users, err := input.LoadCSVDirectoryToMapWithOptions(".", keyFunc,
+//	    input.LoadOptions{DecodeOptions: input.DecodeOptions{FS: fsys}})
+func OpenArchive(archivePath string) (fs.FS, error) {
+	return OpenArchiveWithOptions(archivePath, ArchiveOptions{})
+}
+
+// OpenArchiveWithOptions is OpenArchive with size limits.
+func OpenArchiveWithOptions(archivePath string, opts ArchiveOptions) (fs.FS, error) {
+	opts = opts.withDefaults()
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer f.Close()
+	data, err := readLimited(f, opts.MaxSize, "archive")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+	}
+
+	var fsys fs.FS
+	switch name := strings.ToLower(archivePath); {
+	case strings.HasSuffix(name, ".zip"):
+		fsys, err = zipFS(data, opts)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			fsys, err = TarFSWithOptions(gz, opts)
+		}
+	case strings.HasSuffix(name, ".tar"):
+		fsys, err = TarFSWithOptions(bytes.NewReader(data), opts)
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", archivePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+	}
+	return fsys, nil
+}
+
+// TarFS reads an uncompressed tar stream into an in-memory fs.FS. Only
+// regular files and directories are kept; leading "./" and "/" are stripped
+// from entry names, and entries escaping the archive root are rejected, as
+// are duplicate entries and files sharing their path with a directory.
+func TarFS(r io.Reader) (fs.FS, error) {
+	return TarFSWithOptions(r, ArchiveOptions{})
+}
+
+// TarFSWithOptions is TarFS with size limits.
+func TarFSWithOptions(r io.Reader, opts ArchiveOptions) (fs.FS, error) {
+	b := newMemFSBuilder(opts)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		name := path.Clean(strings.TrimLeft(hdr.Name, "/"))
+		if name == "." && hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid tar entry name %q", hdr.Name)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			err = b.addDir(name)
+		} else {
+			err = b.addFile(name, tr, fs.FileMode(hdr.Mode).Perm(), hdr.ModTime)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.build(), nil
+}
+
+// zipFS reads every entry of a zip archive into an in-memory fs.FS.
+func zipFS(data []byte, opts ArchiveOptions) (fs.FS, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	b := newMemFSBuilder(opts)
+	for _, zf := range zr.File {
+		name := path.Clean(zf.Name)
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid zip entry name %q", zf.Name)
+		}
+		if zf.FileInfo().IsDir() {
+			if err := b.addDir(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("zip entry %s: %w", zf.Name, err)
+		}
+		err = b.addFile(name, rc, zf.Mode().Perm(), zf.Modified)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.build(), nil
+}
+
+// readLimited reads r to the end, failing once more than limit bytes come.
+func readLimited(r io.Reader, limit int64, what string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", what, limit)
+	}
+	return data, nil
+}
+
+// memFSBuilder collects archive entries, enforcing ArchiveOptions and
+// rejecting duplicate names and files that collide with directories.
+type memFSBuilder struct {
+	opts  ArchiveOptions
+	total int64
+	files map[string]*memFile
+	dirs  map[string]bool
+}
+
+func newMemFSBuilder(opts ArchiveOptions) *memFSBuilder {
+	return &memFSBuilder{
+		opts:  opts.withDefaults(),
+		files: map[string]*memFile{},
+		dirs:  map[string]bool{".": true},
+	}
+}
+
+// addDir records name and its parents as directories.
+func (b *memFSBuilder) addDir(name string) error {
+	for ; name != "."; name = path.Dir(name) {
+		if _, ok := b.files[name]; ok {
+			return fmt.Errorf("archive entry %q is both a file and a directory", name)
+		}
+		b.dirs[name] = true
+	}
+	return nil
+}
+
+func (b *memFSBuilder) addFile(name string, r io.Reader, mode fs.FileMode, modTime time.Time) error {
+	if _, ok := b.files[name]; ok {
+		return fmt.Errorf("duplicate archive entry %q", name)
+	}
+	if b.dirs[name] {
+		return fmt.Errorf("archive entry %q is both a file and a directory", name)
+	}
+	if err := b.addDir(path.Dir(name)); err != nil {
+		return err
+	}
+
+	limit := min(b.opts.MaxFileSize, b.opts.MaxSize-b.total)
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		if limit == b.opts.MaxFileSize {
+			return fmt.Errorf("archive entry %s is larger than %d bytes", name, b.opts.MaxFileSize)
+		}
+		return fmt.Errorf("archive is larger than %d bytes decompressed", b.opts.MaxSize)
+	}
+	b.total += int64(len(data))
+	b.files[name] = &memFile{name: path.Base(name), data: data, mode: mode, modTime: modTime}
+	return nil
+}
+
+// build indexes the entries of each directory once, so opening a directory
+// does not scan the whole archive.
+func (b *memFSBuilder) build() memFS {
+	m := memFS{files: b.files, dirs: make(map[string][]fs.DirEntry, len(b.dirs))}
+	for dir := range b.dirs {
+		m.dirs[dir] = []fs.DirEntry{}
+	}
+	for dir := range b.dirs {
+		if dir != "." {
+			parent := path.Dir(dir)
+			m.dirs[parent] = append(m.dirs[parent], fs.FileInfoToDirEntry(&memFile{name: path.Base(dir), mode: fs.ModeDir | 0o555}))
+		}
+	}
+	for name, f := range b.files {
+		parent := path.Dir(name)
+		m.dirs[parent] = append(m.dirs[parent], fs.FileInfoToDirEntry(f))
+	}
+	for _, entries := range m.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return m
+}
+
+// memFS is a read-only in-memory file system keyed by slash-separated path,
+// with the sorted entries of every directory.
+type memFS struct {
+	files map[string]*memFile
+	dirs  map[string][]fs.DirEntry
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m.files[name]; ok {
+		return &openMemFile{memFile: f, Reader: bytes.NewReader(f.data)}, nil
+	}
+	entries, ok := m.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openMemDir{info: &memFile{name: path.Base(name), mode: fs.ModeDir | 0o555}, entries: entries}, nil
+}
+
+// memFile is a file held in memory; it doubles as its own fs.FileInfo.
+type memFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() any           { return nil }
+
+type openMemFile struct {
+	*memFile
+	*bytes.Reader
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f.memFile, nil }
+func (f *openMemFile) Close() error               { return nil }
+
+type openMemDir struct {
+	info    *memFile
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openMemDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openMemDir) Close() error               { return nil }
+
+func (d *openMemDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *openMemDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,201 @@
+package input_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+var archiveFiles = map[string]string{
+	"./state/users.csv":       "id,email,score\n1,alice@example.com,100\n",
+	"state/nested/admins.csv": "id,email,score\n2,bob@example.com,80\n",
+	"README.md":               "# desired state\n",
+}
+
+func tarBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "state/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(filepath.ToSlash(filepath.Clean(name)))
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestOpenArchive_LoadsCSVDirectory(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	archives := map[string][]byte{
+		"state.tar":    tarBytes(t, archiveFiles),
+		"state.tar.gz": gzipBytes(t, tarBytes(t, archiveFiles)),
+		"state.tgz":    gzipBytes(t, tarBytes(t, archiveFiles)),
+		"state.zip":    zipBytes(t, archiveFiles),
+	}
+
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			fsys, err := input.OpenArchive(testutils.CreateMockFile(t, dir, name, data))
+			require.NoError(t, err)
+
+			opts := input.LoadOptions{}
+			opts.FS = fsys
+			records, err := input.LoadCSVDirectoryToMapWithOptions(
+				"state", func(u TestUser) string { return u.ID }, opts)
+			require.NoError(t, err)
+			require.Len(t, records, 2)
+			require.Equal(t, "bob@example.com", records["2"].Email)
+		})
+	}
+}
+
+func TestOpenArchive_UnsupportedFormat(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "state.rar", []byte("x"))
+
+	_, err := input.OpenArchive(path)
+	require.ErrorContains(t, err, "unsupported archive format")
+}
+
+func TestOpenArchive_CorruptArchive(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "state.tar.gz", []byte("not gzip"))
+
+	_, err := input.OpenArchive(path)
+	require.ErrorContains(t, err, "failed to read archive")
+}
+
+func TestTarFS_ConformsToFS(t *testing.T) {
+	fsys, err := input.TarFS(bytes.NewReader(tarBytes(t, archiveFiles)))
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys, "state/users.csv", "state/nested/admins.csv", "README.md"))
+
+	_, err = fs.Stat(fsys, "missing.csv")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestTarFS_RejectsEscapingEntries(t *testing.T) {
+	_, err := input.TarFS(bytes.NewReader(tarBytes(t, map[string]string{"../evil.csv": "id\n"})))
+	require.ErrorContains(t, err, "invalid tar entry name")
+}
+
+// tarEntries writes a tar stream holding the name/content pairs in order;
+// names ending in "/" are directories.
+func tarEntries(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e[0], Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(e[1]))}
+		if strings.HasSuffix(e[0], "/") {
+			hdr = &tar.Header{Name: e[0], Typeflag: tar.TypeDir, Mode: 0o755}
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(e[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestTarFS_RejectsDuplicateEntries(t *testing.T) {
+	_, err := input.TarFS(bytes.NewReader(tarEntries(t,
+		[2]string{"users.csv", "id\n1\n"},
+		[2]string{"./users.csv", "id\n2\n"},
+	)))
+	require.ErrorContains(t, err, `duplicate archive entry "users.csv"`)
+}
+
+func TestTarFS_RejectsFileDirectoryCollisions(t *testing.T) {
+	for name, entries := range map[string][][2]string{
+		"file first":      {{"a", "x"}, {"a/b.csv", "id\n"}},
+		"file last":       {{"a/b.csv", "id\n"}, {"a", "x"}},
+		"directory entry": {{"a/", ""}, {"a", "x"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := input.TarFS(bytes.NewReader(tarEntries(t, entries...)))
+			require.ErrorContains(t, err, `archive entry "a" is both a file and a directory`)
+		})
+	}
+}
+
+func TestTarFS_ListsDirectories(t *testing.T) {
+	fsys, err := input.TarFS(bytes.NewReader(tarEntries(t,
+		[2]string{"empty/", ""},
+		[2]string{"state/b.csv", "id\n"},
+		[2]string{"state/a.csv", "id\n"},
+	)))
+	require.NoError(t, err)
+
+	entries, err := fs.ReadDir(fsys, "state")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "a.csv", entries[0].Name())
+
+	entries, err = fs.ReadDir(fsys, "empty")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestTarFS_SizeLimits(t *testing.T) {
+	data := tarEntries(t, [2]string{"a.csv", "0123456789"}, [2]string{"b.csv", "0123456789"})
+
+	_, err := input.TarFSWithOptions(bytes.NewReader(data), input.ArchiveOptions{MaxFileSize: 5})
+	require.ErrorContains(t, err, "archive entry a.csv is larger than 5 bytes")
+
+	_, err = input.TarFSWithOptions(bytes.NewReader(data), input.ArchiveOptions{MaxSize: 15})
+	require.ErrorContains(t, err, "archive is larger than 15 bytes decompressed")
+
+	_, err = input.TarFSWithOptions(bytes.NewReader(data), input.ArchiveOptions{MaxSize: 20})
+	require.NoError(t, err)
+}
+
+func TestOpenArchiveWithOptions_GzipBomb(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	bomb := gzipBytes(t, tarEntries(t, [2]string{"big.csv", strings.Repeat("0", 1<<20)}))
+	path := testutils.CreateMockFile(t, dir, "state.tar.gz", bomb)
+
+	_, err := input.OpenArchiveWithOptions(path, input.ArchiveOptions{MaxSize: 64 << 10})
+	require.ErrorContains(t, err, "archive is larger than 65536 bytes decompressed")
+}
+
+func TestOpenArchive_ZipRejectsDuplicateEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"users.csv", "users.csv"} {
+		_, err := zw.Create(name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	path := testutils.CreateMockFile(t, testutils.NewTestDir(t), "state.zip", buf.Bytes())
+
+	_, err := input.OpenArchive(path)
+	require.ErrorContains(t, err, `duplicate archive entry "users.csv"`)
+}
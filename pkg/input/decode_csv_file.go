@@ -1,20 +1,26 @@
 package input
 
-import (
-	"fmt"
-	"reflect"
-	"strconv"
-	"strings"
-)
-
 // DecodeCSVFile reads a CSV file from the specified path and decodes its contents
 // into a slice of structs of type T. The struct fields must be tagged with `csv`
 // tags corresponding to the CSV column headers.
 //
 // The function validates that all required CSV columns defined by the struct tags
-// exist in the file. Extra CSV columns are allowed and ignored.
+// exist in the file. Extra CSV columns are allowed and ignored. A column may be
+// matched by an alternative header (`csv:"email,alias=Email|e-mail"`), marked
+// `optional` so a missing column decodes as empty, or given a `default=V` used
+// for a missing column or empty cell. A UTF-8 byte order mark is stripped from
+// the first header.
+//
+// Supported field types include string, int (and int32/int64), float32/float64, and
+// pointers to these types.
+// Composite fields are supported through tag options:
 //
-// Supported field types include string, int (and int32/int64), and pointers to these types.
+//   - slices of scalars split a cell on a separator: `csv:"roles,split=|"` decodes "admin|dev"
+//   - maps of scalars read key/value pairs: `csv:"labels,kv=;="` decodes "env=prod;tier=web"
+//   - struct fields tagged `inline` are flattened, with the tag name used as a column
+//     prefix: `csv:"addr_,inline"` reads the nested `csv:"city"` field from column "addr_city"
+//
+// Empty cells decode to nil pointers, slices and maps.
 //
 // Returns an error if the file is empty, the CSV is malformed, required columns are missing,
 // unsupported field types are encountered, or conversion errors occur.
@@ -32,108 +38,23 @@ import (
 //	    // handle error
 //	}
 func DecodeCSVFile[T any](filePath string) ([]T, error) {
-	records, err := ReadCSVLines(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error loading data file: %w", err)
-	}
-
-	headers := records[0]
-	headerMap := map[string]int{}
-	for i, h := range headers {
-		headerMap[h] = i
-	}
-
-	typ := reflect.TypeOf((*T)(nil)).Elem()
-
-	if typ.Kind() == reflect.Pointer {
-		return nil, fmt.Errorf("type parameter T must be a struct, not a pointer to struct")
-	}
-	if typ.Kind() != reflect.Struct {
-		return nil, fmt.Errorf("type parameter T must be a struct")
-	}
-
-	fieldMap := map[string]int{}
-
-	// Collect csv tags and fallback to field names
-	// add test case it should only parse csv tag not any other
-	for i := 0; i < typ.NumField(); i++ {
-		tag := typ.Field(i).Tag.Get("csv")
-		csvKey := strings.Split(tag, ",")[0]
-		if csvKey != "" {
-			fieldMap[csvKey] = i
-		}
-	}
-
-	// Check all required fields exist in CSV headers
-	for key := range fieldMap {
-		if _, ok := headerMap[key]; !ok {
-			return nil, fmt.Errorf("missing required column: %s", key)
-		}
-	}
+	return DecodeCSVFileWithOptions[T](filePath, DecodeOptions{})
+}
 
+// DecodeCSVFileWithOptions is DecodeCSVFile with explicit DecodeOptions.
+//
+// In lenient mode every bad cell is reported rather than only the first one:
+// the returned slice holds the rows that decoded cleanly and the error, if
+// non-nil, is a DecodeErrors listing the file, line, column, raw value and
+// cause of each problem. Type errors in T are still returned immediately.
+func DecodeCSVFileWithOptions[T any](filePath string, opts DecodeOptions) ([]T, error) {
 	var result []T
-	for rowIndex, row := range records[1:] {
-		entry := reflect.New(typ).Elem()
-
-		for key, idx := range fieldMap {
-			rawValue := ""
-			colIndex, ok := headerMap[key]
-			if ok && colIndex < len(row) {
-				rawValue = strings.TrimSpace(row[colIndex])
-			}
-
-			field := entry.Field(idx)
-			if !field.CanSet() {
-				return nil, fmt.Errorf("cannot set field '%s'", key)
-			}
-
-			fieldType := field.Type()
-			kind := fieldType.Kind()
-
-			if kind == reflect.Pointer {
-				elemKind := fieldType.Elem().Kind()
-
-				if rawValue == "" {
-					field.Set(reflect.Zero(fieldType))
-					continue
-				}
-
-				ptrVal := reflect.New(fieldType.Elem())
-				switch elemKind {
-				case reflect.String:
-					ptrVal.Elem().SetString(rawValue)
-				case reflect.Int, reflect.Int64, reflect.Int32:
-					intVal, err := strconv.Atoi(rawValue)
-					if err != nil {
-						return nil, fmt.Errorf("invalid int value for field '%s' at row %d: %v", key, rowIndex+2, err)
-					}
-					ptrVal.Elem().SetInt(int64(intVal))
-				default:
-					return nil, fmt.Errorf("unsupported pointer element type for field '%s'", key)
-				}
-				field.Set(ptrVal)
-				continue
-			}
-
-			switch kind {
-			case reflect.String:
-				field.SetString(rawValue)
-			case reflect.Int, reflect.Int64, reflect.Int32:
-				if rawValue == "" {
-					field.SetInt(0)
-					continue
-				}
-				intVal, err := strconv.Atoi(rawValue)
-				if err != nil {
-					return nil, fmt.Errorf("invalid int value for field '%s' at row %d: %v", key, rowIndex+2, err)
-				}
-				field.SetInt(int64(intVal))
-			default:
-				return nil, fmt.Errorf("unsupported field type '%s' for field '%s'", kind.String(), key)
-			}
-		}
-		result = append(result, entry.Interface().(T))
+	err := StreamCSVFile(filePath, opts, func(rec T, _ Location) error {
+		result = append(result, rec)
+		return nil
+	})
+	if err != nil && !opts.Lenient {
+		return nil, err
 	}
-
-	return result, nil
+	return result, err
 }
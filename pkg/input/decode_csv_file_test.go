@@ -27,8 +27,8 @@ type NoTagRecord struct {
 }
 
 type UnsupportedFieldRecord struct {
-	ID    string  `csv:"id"`
-	Extra float64 `csv:"extra"`
+	ID    string     `csv:"id"`
+	Extra complex128 `csv:"extra"`
 }
 
 func TestDecodeCSVFile_SimpleRecords(t *testing.T) {
@@ -197,7 +197,7 @@ func TestDecodeCSVFile_UnsupportedPointerElementType_Error(t *testing.T) {
 	path := testutils.CreateMockFile(t, dir, "unsupported_pointer.csv", content)
 
 	type UnsupportedPointer struct {
-		UnsupportedField *float64 `csv:"unsupported_field"` // float64 pointer unsupported
+		UnsupportedField *complex128 `csv:"unsupported_field"` // complex128 pointer unsupported
 	}
 
 	_, err := input.DecodeCSVFile[UnsupportedPointer](path)
@@ -247,3 +247,259 @@ func TestDecodeCSVFile_IntFieldEmptyValue_SetsZero(t *testing.T) {
 	// record 2 score should be 7
 	require.Equal(t, 7, records[1].Score)
 }
+
+func TestDecodeCSVFile_CompositeFields(t *testing.T) {
+	type Address struct {
+		City string `csv:"city"`
+		Zip  *int   `csv:"zip"`
+	}
+	type Rec struct {
+		ID     string            `csv:"id"`
+		Roles  []string          `csv:"roles,split=|"`
+		Scores []int             `csv:"scores,split=;"`
+		Labels map[string]string `csv:"labels,kv=;="`
+		Addr   Address           `csv:"addr_,inline"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,roles,scores,labels,addr_city,addr_zip\n" +
+		"1,admin| dev |,1;2,env=prod; tier=web,Paris,75001\n" +
+		"2,,,,,\n")
+	path := testutils.CreateMockFile(t, dir, "composite.csv", content)
+
+	records, err := input.DecodeCSVFile[Rec](path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	require.Equal(t, []string{"admin", "dev"}, records[0].Roles)
+	require.Equal(t, []int{1, 2}, records[0].Scores)
+	require.Equal(t, map[string]string{"env": "prod", "tier": "web"}, records[0].Labels)
+	require.Equal(t, "Paris", records[0].Addr.City)
+	require.Equal(t, 75001, *records[0].Addr.Zip)
+
+	require.Nil(t, records[1].Roles)
+	require.Nil(t, records[1].Labels)
+	require.Nil(t, records[1].Addr.Zip)
+}
+
+func TestDecodeCSVFile_EmbeddedInlineWithoutPrefix(t *testing.T) {
+	type Audit struct {
+		Owner string `csv:"owner"`
+	}
+	type Rec struct {
+		ID    string `csv:"id"`
+		Audit `csv:",inline"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "embedded.csv", []byte("id,owner\n1,ops\n"))
+
+	records, err := input.DecodeCSVFile[Rec](path)
+	require.NoError(t, err)
+	require.Equal(t, "ops", records[0].Owner)
+}
+
+func TestDecodeCSVFile_InlineMissingPrefixedColumn_Error(t *testing.T) {
+	type Address struct {
+		City string `csv:"city"`
+	}
+	type Rec struct {
+		Addr Address `csv:"addr_,inline"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "inline.csv", []byte("city\nParis\n"))
+
+	_, err := input.DecodeCSVFile[Rec](path)
+	require.ErrorContains(t, err, "missing required column: addr_city")
+}
+
+func TestDecodeCSVFile_CompositeDefaultSeparators(t *testing.T) {
+	type Rec struct {
+		Roles  []string       `csv:"roles"`
+		Limits map[string]int `csv:"limits"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "defaults.csv", []byte("roles,limits\n\"a, b\",cpu=2;mem=4\n"))
+
+	records, err := input.DecodeCSVFile[Rec](path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, records[0].Roles)
+	require.Equal(t, map[string]int{"cpu": 2, "mem": 4}, records[0].Limits)
+}
+
+func TestDecodeCSVFile_InvalidSliceElement_Error(t *testing.T) {
+	type Rec struct {
+		Scores []int `csv:"scores,split=|"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "bad_slice.csv", []byte("scores\n1|x\n"))
+
+	_, err := input.DecodeCSVFile[Rec](path)
+	require.ErrorContains(t, err, "invalid list value for field 'scores' at row 2")
+}
+
+func TestDecodeCSVFile_MalformedMapPair_Error(t *testing.T) {
+	type Rec struct {
+		Labels map[string]string `csv:"labels,kv=;="`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "bad_map.csv", []byte("labels\nenv\n"))
+
+	_, err := input.DecodeCSVFile[Rec](path)
+	require.ErrorContains(t, err, "invalid map value for field 'labels' at row 2")
+}
+
+func TestDecodeCSVFile_CompositeTagOptionErrors(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "opts.csv", []byte("roles,labels,addr\na,b,c\n"))
+
+	type BadKV struct {
+		Labels map[string]string `csv:"labels,kv=;"`
+	}
+	_, err := input.DecodeCSVFile[BadKV](path)
+	require.ErrorContains(t, err, "kv option must be two characters")
+
+	type InlineScalar struct {
+		Addr string `csv:"addr,inline"`
+	}
+	_, err = input.DecodeCSVFile[InlineScalar](path)
+	require.ErrorContains(t, err, "inline field 'Addr' must be a struct")
+}
+
+func TestDecodeCSVFileWithOptions_LenientCollectsAllErrors(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,name,age\n1,Alice,30\n2,Bob,abc\n3,Carol,31\n4,Dan,x\n")
+	path := testutils.CreateMockFile(t, dir, "typos.csv", content)
+
+	records, err := input.DecodeCSVFileWithOptions[SimpleRecord](path, input.DecodeOptions{Lenient: true})
+	require.Len(t, records, 2)
+	require.Equal(t, "Alice", records[0].Name)
+	require.Equal(t, "Carol", records[1].Name)
+
+	var errs input.DecodeErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	require.Equal(t, path, errs[0].File)
+	require.Equal(t, 3, errs[0].Line)
+	require.Equal(t, "age", errs[0].Column)
+	require.Equal(t, "abc", errs[0].Value)
+	require.Equal(t, SimpleRecord{ID: "2", Name: "Bob"}, errs[0].Record)
+	require.Equal(t, 5, errs[1].Line)
+	require.ErrorContains(t, err, "2 CSV decode error(s)")
+	require.ErrorContains(t, err, "invalid int value for field 'age' at row 5")
+}
+
+func TestDecodeCSVFileWithOptions_LenientReportsEveryMissingColumn(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "cols.csv", []byte("id\n1\n"))
+
+	records, err := input.DecodeCSVFileWithOptions[SimpleRecord](path, input.DecodeOptions{Lenient: true})
+	require.Empty(t, records)
+
+	var errs input.DecodeErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	require.Equal(t, "name", errs[0].Column)
+	require.Equal(t, "age", errs[1].Column)
+	require.Nil(t, errs[0].Record)
+}
+
+func TestDecodeCSVFileWithOptions_StrictReturnsDecodeError(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "strict.csv", []byte("id,name,age\n1,Alice,abc\n2,Bob,x\n"))
+
+	records, err := input.DecodeCSVFileWithOptions[SimpleRecord](path, input.DecodeOptions{})
+	require.Nil(t, records)
+
+	var decodeErr *input.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	require.Equal(t, 2, decodeErr.Line)
+	require.Equal(t, "abc", decodeErr.Value)
+}
+
+type AliasedRecord struct {
+	ID    string   `csv:"id"`
+	Email string   `csv:"email,alias=Email|e-mail"`
+	Tier  string   `csv:"tier,default=free"`
+	Score *int     `csv:"score,optional"`
+	Team  []string `csv:"team,optional,split=|"`
+}
+
+func TestDecodeCSVFile_AliasesOptionalAndDefaults(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "aliases.csv", []byte("id,e-mail,tier\n1,a@x.com,pro\n2,b@x.com,\n"))
+
+	records, err := input.DecodeCSVFile[AliasedRecord](path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, AliasedRecord{ID: "1", Email: "a@x.com", Tier: "pro"}, records[0])
+	require.Equal(t, AliasedRecord{ID: "2", Email: "b@x.com", Tier: "free"}, records[1])
+}
+
+func TestDecodeCSVFile_DefaultAppliesToMissingColumn(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "defaults.csv", []byte("id,email\n1,a@x.com\n"))
+
+	records, err := input.DecodeCSVFile[AliasedRecord](path)
+	require.NoError(t, err)
+	require.Equal(t, "free", records[0].Tier)
+	require.Nil(t, records[0].Score)
+}
+
+func TestDecodeCSVFile_StripsByteOrderMark(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "bom.csv", []byte("\xef\xbb\xbfid,name,age\n1,Alice,30\n"))
+
+	records, err := input.DecodeCSVFile[SimpleRecord](path)
+	require.NoError(t, err)
+	require.Equal(t, "1", records[0].ID)
+}
+
+func TestDecodeCSVFileWithOptions_CaseInsensitiveHeaders(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "case.csv", []byte("ID, Name ,AGE\n1,Alice,30\n"))
+
+	_, err := input.DecodeCSVFile[SimpleRecord](path)
+	require.ErrorContains(t, err, "missing required column: id")
+
+	records, err := input.DecodeCSVFileWithOptions[SimpleRecord](path, input.DecodeOptions{CaseInsensitiveHeaders: true})
+	require.NoError(t, err)
+	require.Equal(t, SimpleRecord{ID: "1", Name: "Alice", Age: 30}, records[0])
+}
+
+func TestDecodeCSVFile_InvalidDefault_Error(t *testing.T) {
+	type Rec struct {
+		Age int `csv:"age,default=old"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "bad_default.csv", []byte("age\n1\n"))
+
+	_, err := input.DecodeCSVFile[Rec](path)
+	require.ErrorContains(t, err, `invalid default "old" for field 'age'`)
+}
+
+func TestDecodeCSVFile_FloatFields(t *testing.T) {
+	type Priced struct {
+		ID       string   `csv:"id"`
+		Price    float64  `csv:"price"`
+		Discount *float64 `csv:"discount"`
+	}
+
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "prices.csv", []byte("id,price,discount\n1,19.99,\n2,5,0.25\n"))
+
+	records, err := input.DecodeCSVFile[Priced](path)
+	require.NoError(t, err)
+	require.Equal(t, 19.99, records[0].Price)
+	require.Nil(t, records[0].Discount)
+	require.Equal(t, 0.25, *records[1].Discount)
+
+	path = testutils.CreateMockFile(t, dir, "bad.csv", []byte("id,price,discount\n1,free,\n"))
+	_, err = input.DecodeCSVFile[Priced](path)
+	require.ErrorContains(t, err, "invalid float value for field 'price' at row 2")
+}
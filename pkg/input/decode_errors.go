@@ -0,0 +1,58 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecodeError describes a CSV file, row or cell that could not be decoded.
+type DecodeError struct {
+	File   string // path of the CSV file
+	Line   int    // 1-based line number; 0 when the error concerns the whole file
+	Column string // CSV header of the offending cell; empty for file-level errors
+	Value  string // raw (trimmed) cell value
+	Err    error  // underlying cause
+
+	// Record holds the partially decoded row (fields that failed keep their
+	// zero value) as a T, or nil for file-level errors. It lets callers still
+	// extract a key from a row that could not be fully decoded. Interpolated
+	// cells hold their `${...}` templates, not the resolved values.
+	Record any
+
+	kind string // value kind named in cell errors, e.g. "int"
+}
+
+func (e *DecodeError) Error() string {
+	if e.kind != "" {
+		return fmt.Sprintf("%s: invalid %s value for field '%s' at row %d: %v", e.File, e.kind, e.Column, e.Line, e.Err)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors collects every DecodeError found in lenient mode, in file and
+// row order.
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("%d CSV decode error(s):\n  %s", len(e), strings.Join(lines, "\n  "))
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As.
+func (e DecodeErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,138 @@
+package input
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// discoverCSVFiles lists the files under dirPath selected by opts, in load
+// order. See LoadCSVDirectoryToMapWithOptions for the selection rules.
+func discoverCSVFiles(dirPath string, opts LoadOptions) ([]string, error) {
+	for _, pattern := range append(append([]string{}, opts.IncludeGlobs...), opts.ExcludeGlobs...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+
+	walk := filepath.WalkDir
+	relative := func(p string) string {
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return filepath.ToSlash(p)
+		}
+		return filepath.ToSlash(rel)
+	}
+	if opts.FS != nil {
+		walk = func(root string, fn fs.WalkDirFunc) error {
+			return fs.WalkDir(opts.FS, root, fn)
+		}
+		relative = func(p string) string {
+			if dirPath == "." {
+				return p
+			}
+			return strings.TrimPrefix(p, dirPath+"/")
+		}
+	}
+
+	type file struct{ path, rel string }
+	var files []file
+	err := walk(dirPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dirPath {
+			if !d.IsDir() {
+				// dirPath names a single file: load it regardless of filters.
+				files = append(files, file{p, path.Base(filepath.ToSlash(p))})
+			}
+			return nil
+		}
+
+		rel := relative(p)
+		if d.IsDir() {
+			if opts.NonRecursive || matchAnyGlob(opts.ExcludeGlobs, rel) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if matchAnyGlob(opts.ExcludeGlobs, rel) {
+			return nil
+		}
+		if len(opts.IncludeGlobs) > 0 {
+			if !matchAnyGlob(opts.IncludeGlobs, rel) {
+				return nil
+			}
+		} else if !isCSVFile(p) {
+			return nil // skip non-csv files
+		}
+		files = append(files, file{p, rel})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return lessPathSegments(files[i].rel, files[j].rel)
+	})
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// lessPathSegments orders slash-separated paths segment by segment, so a
+// directory's files sort next to each other: "a/z.csv" < "a-b.csv" because
+// segment "a" sorts before "a-b.csv".
+func lessPathSegments(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash-separated name matches pattern. Each
+// pattern segment follows path.Match, and a "**" segment matches zero or more
+// whole segments, so "**/*.csv" matches "a.csv" and "x/y/a.csv" while
+// "*.csv" only matches files at the top level.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
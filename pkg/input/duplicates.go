@@ -0,0 +1,175 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// DuplicatePolicy controls what LoadCSVDirectoryToMapWithOptions does when
+// the same key appears on more than one row. Zero value = DuplicateLastWins
+// (preserves the original overwrite behavior).
+type DuplicatePolicy int
+
+const (
+	// DuplicateLastWins keeps the row read last. Default.
+	DuplicateLastWins DuplicatePolicy = iota
+	// DuplicateFirstWins keeps the row read first and drops later ones.
+	DuplicateFirstWins
+	// DuplicateError fails the load with a DuplicateKeyError listing every
+	// duplicated key and where each occurrence was found.
+	DuplicateError
+	// DuplicateMerge combines the rows column by column: a column left empty
+	// (zero value) on one row is filled from another. Two rows setting the
+	// same column to different values fail the load with a DuplicateKeyError.
+	DuplicateMerge
+)
+
+// Location identifies a row within a CSV file.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// DuplicateKey describes one key found on more than one row.
+type DuplicateKey struct {
+	Key       any        // the key as returned by keyFunc
+	Locations []Location // every occurrence, in load order
+	Columns   []string   // columns with conflicting values (DuplicateMerge only)
+}
+
+// DuplicateKeyError reports every duplicated key found while loading, in the
+// order the duplicates were encountered.
+type DuplicateKeyError struct {
+	Duplicates []DuplicateKey
+}
+
+func (e *DuplicateKeyError) Error() string {
+	lines := make([]string, len(e.Duplicates))
+	for i, d := range e.Duplicates {
+		locs := make([]string, len(d.Locations))
+		for j, l := range d.Locations {
+			locs[j] = l.String()
+		}
+		lines[i] = fmt.Sprintf("key %q at %s", fmt.Sprint(d.Key), strings.Join(locs, ", "))
+		if len(d.Columns) > 0 {
+			lines[i] += fmt.Sprintf(" (conflicting columns: %s)", strings.Join(d.Columns, ", "))
+		}
+	}
+	return fmt.Sprintf("%d duplicate key(s) found:\n  %s", len(e.Duplicates), strings.Join(lines, "\n  "))
+}
+
+// duplicateTracker applies a DuplicatePolicy while rows are merged into the
+// result map and records the locations needed to report duplicates.
+type duplicateTracker[T any, K comparable] struct {
+	policy    DuplicatePolicy
+	plan      *schema.Schema
+	seen      map[K][]Location
+	order     []K
+	conflicts map[K][]string
+}
+
+func newDuplicateTracker[T any, K comparable](policy DuplicatePolicy) (*duplicateTracker[T, K], error) {
+	t := &duplicateTracker[T, K]{policy: policy}
+	if policy == DuplicateError || policy == DuplicateMerge {
+		t.seen = map[K][]Location{}
+		t.conflicts = map[K][]string{}
+	}
+	if policy == DuplicateMerge {
+		plan, err := buildFieldPlan(reflect.TypeOf((*T)(nil)).Elem())
+		if err != nil {
+			return nil, err
+		}
+		t.plan = plan
+	}
+	return t, nil
+}
+
+// addResult reports what duplicateTracker.add did with a record.
+type addResult int
+
+const (
+	addStored    addResult = iota // rec is now the record for its key
+	addDiscarded                  // an earlier record for the key was kept
+	addMerged                     // rec was merged into the earlier record
+)
+
+// add merges rec, read at loc, into records under key.
+func (t *duplicateTracker[T, K]) add(records map[K]T, key K, rec T, loc Location) addResult {
+	existing, exists := records[key]
+	if t.seen != nil {
+		if len(t.seen[key]) == 1 {
+			t.order = append(t.order, key)
+		}
+		t.seen[key] = append(t.seen[key], loc)
+	}
+	if !exists {
+		records[key] = rec
+		return addStored
+	}
+
+	switch t.policy {
+	case DuplicateFirstWins, DuplicateError:
+		// keep the existing record; DuplicateError reports via err()
+		return addDiscarded
+	case DuplicateMerge:
+		merged, conflicts := t.merge(existing, rec)
+		records[key] = merged
+		for _, c := range conflicts {
+			if !slices.Contains(t.conflicts[key], c) {
+				t.conflicts[key] = append(t.conflicts[key], c)
+			}
+		}
+		return addMerged
+	default:
+		records[key] = rec
+		return addStored
+	}
+}
+
+// merge fills the zero-valued columns of dst from src and returns the
+// columns both set to different values.
+func (t *duplicateTracker[T, K]) merge(dst, src T) (T, []string) {
+	out := reflect.New(t.plan.Type).Elem()
+	out.Set(reflect.ValueOf(dst))
+	from := reflect.ValueOf(src)
+
+	var conflicts []string
+	for i := range t.plan.Fields {
+		f := &t.plan.Fields[i]
+		d := out.FieldByIndex(f.Index)
+		s := from.FieldByIndex(f.Index)
+		switch {
+		case s.IsZero():
+		case d.IsZero():
+			d.Set(s)
+		case !reflect.DeepEqual(d.Interface(), s.Interface()):
+			conflicts = append(conflicts, f.Column)
+		}
+	}
+	return out.Interface().(T), conflicts
+}
+
+// err returns the DuplicateKeyError for the policy, or nil.
+func (t *duplicateTracker[T, K]) err() error {
+	var dups []DuplicateKey
+	for _, key := range t.order {
+		switch {
+		case t.policy == DuplicateError:
+			dups = append(dups, DuplicateKey{Key: key, Locations: t.seen[key]})
+		case len(t.conflicts[key]) > 0:
+			dups = append(dups, DuplicateKey{Key: key, Locations: t.seen[key], Columns: t.conflicts[key]})
+		}
+	}
+	if len(dups) == 0 {
+		return nil
+	}
+	return &DuplicateKeyError{Duplicates: dups}
+}
@@ -0,0 +1,100 @@
+package input
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Latin1 decodes ISO-8859-1 (Latin-1) input to UTF-8. Use it as
+// CSVOptions.Encoding for exports from legacy tools.
+//
+// Any other single- or multi-byte encoding can be plugged in the same way,
+// e.g. with golang.org/x/text:
+//
+//	opts.Encoding = func(r io.Reader) io.Reader {
+//	    return transform.NewReader(r, charmap.Windows1252.NewDecoder())
+//	}
+func Latin1(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	return &decodingReader{next: func() (rune, error) {
+		b, err := br.ReadByte()
+		return rune(b), err
+	}}
+}
+
+// UTF16 decodes UTF-16 input to UTF-8. A leading byte order mark selects the
+// byte order and is dropped; without one, little-endian is assumed, as
+// produced by Excel's "Unicode Text" export.
+func UTF16(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	bigEndian, checkedBOM := false, false
+
+	readUnit := func() (uint16, error) {
+		var pair [2]byte
+		if _, err := io.ReadFull(br, pair[:]); err != nil {
+			return 0, err
+		}
+		if bigEndian {
+			return uint16(pair[0])<<8 | uint16(pair[1]), nil
+		}
+		return uint16(pair[1])<<8 | uint16(pair[0]), nil
+	}
+
+	return &decodingReader{next: func() (rune, error) {
+		if !checkedBOM {
+			checkedBOM = true
+			if bom, err := br.Peek(2); err == nil {
+				switch {
+				case bom[0] == 0xFE && bom[1] == 0xFF:
+					bigEndian = true
+					br.Discard(2)
+				case bom[0] == 0xFF && bom[1] == 0xFE:
+					br.Discard(2)
+				}
+			}
+		}
+
+		unit, err := readUnit()
+		if err != nil {
+			return 0, err
+		}
+		if !utf16.IsSurrogate(rune(unit)) {
+			return rune(unit), nil
+		}
+		low, err := readUnit()
+		if errors.Is(err, io.EOF) {
+			return utf8.RuneError, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return utf16.DecodeRune(rune(unit), rune(low)), nil
+	}}
+}
+
+// decodingReader adapts a rune source to an io.Reader producing UTF-8.
+type decodingReader struct {
+	next func() (rune, error)
+	buf  []byte
+	err  error // sticky error from next, returned once buf is drained
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	for len(d.buf) < len(p) && d.err == nil {
+		r, err := d.next()
+		if err != nil {
+			d.err = err
+			break
+		}
+		d.buf = utf8.AppendRune(d.buf, r)
+	}
+	if len(d.buf) == 0 {
+		return 0, d.err
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,53 @@
+package input_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatin1(t *testing.T) {
+	out, err := io.ReadAll(input.Latin1(strings.NewReader("caf\xe9,M\xfcller")))
+	require.NoError(t, err)
+	require.Equal(t, "café,Müller", string(out))
+}
+
+func TestUTF16(t *testing.T) {
+	t.Run("little endian with BOM", func(t *testing.T) {
+		out, err := io.ReadAll(input.UTF16(strings.NewReader("\xff\xfei\x00d\x00\xe9\x00")))
+		require.NoError(t, err)
+		require.Equal(t, "idé", string(out))
+	})
+
+	t.Run("big endian with BOM and surrogate pair", func(t *testing.T) {
+		out, err := io.ReadAll(input.UTF16(strings.NewReader("\xfe\xff\x00a\xd8\x3d\xde\x00")))
+		require.NoError(t, err)
+		require.Equal(t, "a😀", string(out))
+	})
+
+	t.Run("no BOM defaults to little endian", func(t *testing.T) {
+		out, err := io.ReadAll(input.UTF16(strings.NewReader("o\x00k\x00")))
+		require.NoError(t, err)
+		require.Equal(t, "ok", string(out))
+	})
+
+	t.Run("truncated input", func(t *testing.T) {
+		_, err := io.ReadAll(input.UTF16(strings.NewReader("o\x00k")))
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_Latin1TSV(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "users.csv", []byte("id\temail\tscore\n1\tjos\xe9@x.com\t5\n"))
+
+	opts := input.LoadOptions{}
+	opts.CSV = input.CSVOptions{Delimiter: '\t', Encoding: input.Latin1}
+	records, err := input.LoadCSVDirectoryToMapWithOptions(dir, func(u TestUser) string { return u.ID }, opts)
+	require.NoError(t, err)
+	require.Equal(t, "josé@x.com", records["1"].Email)
+}
@@ -0,0 +1,29 @@
+package input
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// buildFieldPlan returns the cached schema used to decode rows into typ,
+// failing if any managed field cannot be decoded from CSV. The schema is
+// shared with the diff and formatter packages and reused for every row.
+func buildFieldPlan(typ reflect.Type) (*schema.Schema, error) {
+	if typ.Kind() == reflect.Pointer {
+		return nil, fmt.Errorf("type parameter T must be a struct, not a pointer to struct")
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type parameter T must be a struct")
+	}
+
+	plan, err := schema.For(typ)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.Err(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
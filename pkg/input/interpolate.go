@@ -0,0 +1,131 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretResolver resolves `${secret:<path>}` references in CSV cells, e.g.
+// against Vault, AWS Secrets Manager or a local keyring.
+type SecretResolver interface {
+	ResolveSecret(path string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to the SecretResolver interface.
+type SecretResolverFunc func(path string) (string, error)
+
+// ResolveSecret calls f(path).
+func (f SecretResolverFunc) ResolveSecret(path string) (string, error) {
+	return f(path)
+}
+
+// Interpolation enables `${...}` references in string and *string cells,
+// expanded after a row is parsed and before the record is validated:
+//
+//   - `${NAME}` is replaced by the environment variable NAME when Env is set
+//     (an undefined variable is an error); otherwise it is kept literally
+//   - `${secret:path}` is replaced by Secrets.ResolveSecret("path"); a secret
+//     reference without a Secrets resolver is an error
+//   - in a run of `$` right before `{`, each `$$` is a literal `$`, and an
+//     odd `$` left over starts a reference: `$${A}` is the literal text
+//     `${A}`, and `$$${A}` is a literal `$` followed by the value of A
+//
+// Other `$` characters are kept as they are.
+//
+// Every cell that contained a reference is sensitive: the plan shows it as
+// "(sensitive)" and the plan file stores the reference rather than the
+// resolved value, which apply.Run resolves again before calling OnAdd and
+// OnUpdate.
+type Interpolation struct {
+	// Env expands `${NAME}` from the environment.
+	Env bool
+
+	// LookupEnv replaces os.LookupEnv, e.g. in tests.
+	LookupEnv func(string) (string, bool)
+
+	// Secrets resolves `${secret:path}` references.
+	Secrets SecretResolver
+}
+
+// Expand replaces every reference in s as described on Interpolation.
+func (in *Interpolation) Expand(s string) (string, error) {
+	out, _, err := in.expand(s)
+	return out, err
+}
+
+// expand is Expand that also reports whether any reference was resolved.
+func (in *Interpolation) expand(s string) (string, bool, error) {
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+
+	var b strings.Builder
+	resolved := false
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		// In the run of '$' before "{", each "$$" is a literal '$', and an
+		// odd '$' left over starts a reference.
+		run := i
+		for run > 0 && s[run-1] == '$' {
+			run--
+		}
+		dollars := i + 1 - run
+		b.WriteString(s[:run])
+		b.WriteString(strings.Repeat("$", dollars/2))
+		if dollars%2 == 0 {
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated reference in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		value, ok, err := in.resolve(ref)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			b.WriteString("${" + ref + "}")
+			continue
+		}
+		b.WriteString(value)
+		resolved = true
+	}
+	return b.String(), resolved, nil
+}
+
+// resolve looks up a single reference; ok is false when it is left as-is.
+func (in *Interpolation) resolve(ref string) (string, bool, error) {
+	if path, isSecret := strings.CutPrefix(ref, "secret:"); isSecret {
+		if in.Secrets == nil {
+			return "", false, fmt.Errorf("no SecretResolver configured for ${%s}", ref)
+		}
+		value, err := in.Secrets.ResolveSecret(path)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to resolve secret %q: %w", path, err)
+		}
+		return value, true, nil
+	}
+
+	if !in.Env {
+		return "", false, nil
+	}
+	lookup := in.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	value, ok := lookup(ref)
+	if !ok {
+		return "", false, fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,154 @@
+package input_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/stretchr/testify/require"
+)
+
+func testInterpolation() *input.Interpolation {
+	env := map[string]string{"REGION": "eu-west-1", "TEAM": "core"}
+	secrets := map[string]string{"db/token": "s3cr3t"}
+	return &input.Interpolation{
+		Env: true,
+		LookupEnv: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+		Secrets: input.SecretResolverFunc(func(path string) (string, error) {
+			if v, ok := secrets[path]; ok {
+				return v, nil
+			}
+			return "", errors.New("not found")
+		}),
+	}
+}
+
+func TestInterpolation_Expand(t *testing.T) {
+	in := testInterpolation()
+
+	tests := map[string]string{
+		"plain":                        "plain",
+		"${REGION}":                    "eu-west-1",
+		"${TEAM}-${REGION}":            "core-eu-west-1",
+		"Bearer ${secret:db/token}":    "Bearer s3cr3t",
+		"$${REGION} stays":             "${REGION} stays",
+		"cost: $5 ${TEAM}":             "cost: $5 core",
+		"${secret:db/token}${TEAM}end": "s3cr3tcoreend",
+		"$$${TEAM}":                    "$core",
+		"$$$${TEAM}":                   "$${TEAM}",
+		"x$${TEAM}${REGION}":           "x${TEAM}eu-west-1",
+		"$$5 ${TEAM}":                  "$$5 core",
+		"{$${TEAM}}":                   "{${TEAM}}",
+	}
+	for in_, want := range tests {
+		got, err := in.Expand(in_)
+		require.NoError(t, err, in_)
+		require.Equal(t, want, got, in_)
+	}
+}
+
+func TestInterpolation_ExpandErrors(t *testing.T) {
+	in := testInterpolation()
+
+	_, err := in.Expand("${MISSING}")
+	require.ErrorContains(t, err, "environment variable MISSING is not set")
+
+	_, err = in.Expand("${secret:nope}")
+	require.ErrorContains(t, err, `failed to resolve secret "nope": not found`)
+
+	_, err = in.Expand("${REGION")
+	require.ErrorContains(t, err, "unterminated reference")
+
+	_, err = (&input.Interpolation{}).Expand("${secret:db/token}")
+	require.ErrorContains(t, err, "no SecretResolver configured")
+}
+
+func TestInterpolation_EnvDisabledKeepsReferences(t *testing.T) {
+	in := testInterpolation()
+	in.Env = false
+
+	got, err := in.Expand("${REGION}/${secret:db/token}")
+	require.NoError(t, err)
+	require.Equal(t, "${REGION}/s3cr3t", got)
+}
+
+type TokenRecord struct {
+	ID     string  `csv:"id"`
+	Token  *string `csv:"token"`
+	Region string  `csv:"region"`
+	Count  int     `csv:"count"`
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_Interpolation(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.csv": {Data: []byte("id,token,region,count\n" +
+			"1,${secret:db/token},${REGION},1\n" +
+			"2,,static,2\n")},
+	}
+
+	templates := map[any]map[string]string{}
+	opts := input.LoadOptions{
+		OnInterpolated: func(key any, t map[string]string) { templates[key] = t },
+	}
+	opts.FS = fsys
+	opts.Interpolation = testInterpolation()
+
+	records, err := input.LoadCSVDirectoryToMapWithOptions(".", func(r TokenRecord) string { return r.ID }, opts)
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", *records["1"].Token)
+	require.Equal(t, "eu-west-1", records["1"].Region)
+	require.Nil(t, records["2"].Token)
+	require.Equal(t, map[any]map[string]string{
+		"1": {"token": "${secret:db/token}", "region": "${REGION}"},
+	}, templates)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_InterpolationOffByDefault(t *testing.T) {
+	fsys := fstest.MapFS{"a.csv": {Data: []byte("id,token,region,count\n1,${secret:x},${REGION},1\n")}}
+
+	opts := input.LoadOptions{}
+	opts.FS = fsys
+	records, err := input.LoadCSVDirectoryToMapWithOptions(".", func(r TokenRecord) string { return r.ID }, opts)
+	require.NoError(t, err)
+	require.Equal(t, "${secret:x}", *records["1"].Token)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_InterpolationErrorIsDecodeError(t *testing.T) {
+	fsys := fstest.MapFS{"a.csv": {Data: []byte("id,token,region,count\n1,x,${UNSET},1\n")}}
+
+	opts := input.LoadOptions{}
+	opts.FS = fsys
+	opts.Interpolation = testInterpolation()
+	_, err := input.LoadCSVDirectoryToMapWithOptions(".", func(r TokenRecord) string { return r.ID }, opts)
+
+	var decodeErr *input.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	require.Equal(t, "region", decodeErr.Column)
+	require.ErrorContains(t, err, "a.csv:2: interpolating field 'region': environment variable UNSET is not set")
+}
+
+func TestLoadCSVOverlaysToMap_TracksInterpolatedColumns(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/a.csv": {Data: []byte("id,token,region,count\n1,${secret:db/token},${REGION},1\n2,t,r,2\n")},
+		"env/a.csv":  {Data: []byte("id,region,token\n1,static,\n2,,${secret:db/token}\n")},
+	}
+
+	templates := map[any]map[string]string{}
+	opts := input.OverlayOptions{}
+	opts.FS = fsys
+	opts.Interpolation = testInterpolation()
+	opts.OnInterpolated = func(key any, t map[string]string) { templates[key] = t }
+
+	records, err := input.LoadCSVOverlaysToMap("base", []string{"env"}, func(r TokenRecord) string { return r.ID }, opts)
+	require.NoError(t, err)
+	require.Equal(t, "static", records["1"].Region)
+	require.Equal(t, "s3cr3t", *records["2"].Token)
+	require.Equal(t, map[any]map[string]string{
+		"1": {"token": "${secret:db/token}"},
+		"2": {"token": "${secret:db/token}"},
+	}, templates)
+}
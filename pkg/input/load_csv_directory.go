@@ -1,17 +1,18 @@
 package input
 
 import (
-	"io/fs"
-	"path/filepath"
+	"errors"
+	"slices"
 )
 
-// LoadCSVDirectoryToMap loads all `.csv` files from a directory, decodes records of type T,
+// LoadCSVDirectoryToMap loads all `.csv` (and gzip-compressed `.csv.gz`) files from a directory, decodes records of type T,
 // and builds a map using a user-defined key extractor.
 //
 // It expects each CSV file in the directory to have headers matching the csv struct tags on T.
 // The keyFunc extracts the map key from each decoded T value.
 // All CSV files are merged into a single result map. If a key appears more than once across files,
-// the later record will overwrite the earlier one.
+// the later record will overwrite the earlier one; use LoadCSVDirectoryToMapWithOptions with a
+// DuplicatePolicy to detect or merge duplicates instead.
 //
 // Returns an error if any CSV file is unreadable or improperly formatted.
 //
@@ -22,31 +23,153 @@ import (
 //	    func(u User) string { return u.ID },
 //	)
 func LoadCSVDirectoryToMap[T any, K comparable](dirPath string, keyFunc func(T) K) (map[K]T, error) {
+	return LoadCSVDirectoryToMapWithOptions(dirPath, keyFunc, LoadOptions{})
+}
+
+// LoadCSVDirectoryToMapWithOptions is LoadCSVDirectoryToMap with explicit LoadOptions.
+//
+// In lenient mode a bad file or row no longer aborts the walk: every CSV file
+// is visited, rows that decode cleanly are merged into the map, and all
+// problems are returned together as DecodeErrors alongside the map.
+//
+// opts.Duplicates decides what happens to a key found on more than one row.
+// With DuplicateError, or DuplicateMerge on conflicting values, the load fails
+// with a DuplicateKeyError naming each key and the file:line of every
+// occurrence.
+//
+// When opts.FS is set, dirPath names a directory within that file system
+// ("." for its root), so CSV files can be loaded from an embed.FS, an
+// fstest.MapFS or an archive opened with OpenArchive.
+//
+// Files are selected and ordered as follows:
+//   - every `.csv` and `.csv.gz` file under dirPath is a candidate; when
+//     opts.IncludeGlobs is set, only files matching one of its patterns are
+//     (whatever their extension)
+//   - files and directories matching any of opts.ExcludeGlobs are skipped
+//   - with opts.NonRecursive, subdirectories are not descended into
+//   - files are loaded in lexical order of their slash-separated path
+//     relative to dirPath, compared segment by segment, so "a/z.csv" loads
+//     before "a-b.csv" and "b.csv"; with DuplicateLastWins the row from the
+//     file loaded last wins
+//
+// Glob patterns are matched against that relative path. Each segment follows
+// path.Match, and a "**" segment matches any number of directories.
+//
+// With opts.IgnoreUnset, files may omit any column; opts.OnUnset then
+// receives, per key, the columns its record left unset.
+func LoadCSVDirectoryToMapWithOptions[T any, K comparable](dirPath string, keyFunc func(T) K, opts LoadOptions) (map[K]T, error) {
 	records := make(map[K]T)
+	var decodeErrs DecodeErrors
+
+	dups, err := newDuplicateTracker[T, K](opts.Duplicates)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates map[K]map[string]string
+	if opts.OnInterpolated != nil {
+		templates = map[K]map[string]string{}
+	}
+	var unset map[K][]string
+	if opts.OnUnset != nil {
+		unset = map[K][]string{}
+	}
 
-	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+	files, err := discoverCSVFiles(dirPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range files {
+		// Merge decoded records into map with keys extracted by keyFunc
+		err = streamCSV(path, opts.DecodeOptions, nil, func(rec T, row *rowInfo) error {
+			key := keyFunc(rec)
+			result := dups.add(records, key, rec, row.loc)
+			if templates != nil {
+				trackTemplates(templates, key, row.templates, result)
+			}
+			if unset != nil {
+				trackUnset(unset, key, row.unset, result)
+			}
+			return nil
+		})
+		var fileErrs DecodeErrors
+		if opts.Lenient && errors.As(err, &fileErrs) {
+			decodeErrs = append(decodeErrs, fileErrs...)
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if d.IsDir() || filepath.Ext(path) != ".csv" {
-			return nil // skip directories and non-csv files
+	}
+	if dupErr := dups.err(); dupErr != nil {
+		if len(decodeErrs) > 0 {
+			return nil, errors.Join(decodeErrs, dupErr)
 		}
-
-		fileRecords, err := DecodeCSVFile[T](path)
-		if err != nil {
-			return err
+		return nil, dupErr
+	}
+	for key, t := range templates {
+		if _, ok := records[key]; ok {
+			opts.OnInterpolated(key, t)
+		}
+	}
+	for key, columns := range unset {
+		if _, ok := records[key]; ok {
+			opts.OnUnset(key, columns)
 		}
+	}
+	if len(decodeErrs) > 0 {
+		return records, decodeErrs
+	}
+	return records, nil
+}
 
-		// Merge fileRecords into map with keys extracted by keyFunc
-		for _, rec := range fileRecords {
-			k := keyFunc(rec)
-			records[k] = rec
+// trackTemplates keeps the interpolation templates of each key in step with
+// the record the duplicate policy kept for it.
+func trackTemplates[K comparable](templates map[K]map[string]string, key K, rowTemplates map[string]string, result addResult) {
+	switch result {
+	case addStored:
+		if rowTemplates == nil {
+			delete(templates, key)
+		} else {
+			templates[key] = rowTemplates
 		}
-		return nil
-	})
+	case addMerged:
+		// Merging only fills columns the earlier record left empty.
+		for column, t := range rowTemplates {
+			if templates[key] == nil {
+				templates[key] = map[string]string{}
+			}
+			if _, ok := templates[key][column]; !ok {
+				templates[key][column] = t
+			}
+		}
+	}
+}
 
-	if err != nil {
-		return nil, err
+// trackUnset keeps the unset columns of each key in step with the record
+// the duplicate policy kept for it.
+func trackUnset[K comparable](unset map[K][]string, key K, rowUnset []string, result addResult) {
+	switch result {
+	case addStored:
+		if len(rowUnset) == 0 {
+			delete(unset, key)
+		} else {
+			unset[key] = rowUnset
+		}
+	case addMerged:
+		// Merging fills the columns the earlier record left empty, so a
+		// column stays unset only if neither row set it.
+		var still []string
+		for _, column := range unset[key] {
+			if slices.Contains(rowUnset, column) {
+				still = append(still, column)
+			}
+		}
+		if len(still) == 0 {
+			delete(unset, key)
+		} else {
+			unset[key] = still
+		}
 	}
-	return records, nil
 }
@@ -2,6 +2,7 @@ package input_test
 
 import (
 	"testing"
+	"testing/fstest"
 
 	"github.com/algebananazzzzz/planear/pkg/input"
 	"github.com/algebananazzzzz/planear/testutils"
@@ -115,3 +116,238 @@ func TestLoadCSVDirectoryToMap_WalkDirError(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "no such file or directory")
 }
+
+func TestLoadCSVDirectoryToMapWithOptions_LenientContinuesWalk(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "a.csv", []byte("id,email,score\n1,a@x.com,oops\n2,b@x.com,2\n"))
+	testutils.CreateMockFile(t, dir, "b.csv", []byte("id,email\n3,c@x.com\n"))
+	testutils.CreateMockFile(t, dir, "c.csv", []byte("id,email,score\n4,d@x.com,4\n"))
+
+	opts := input.LoadOptions{}
+	opts.Lenient = true
+	records, err := input.LoadCSVDirectoryToMapWithOptions(dir, func(u TestUser) string { return u.ID }, opts)
+
+	require.Len(t, records, 2)
+	assert.Contains(t, records, "2")
+	assert.Contains(t, records, "4")
+
+	var errs input.DecodeErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "score", errs[0].Column)
+	assert.Equal(t, 2, errs[0].Line)
+	assert.Contains(t, errs[1].Error(), "missing required column: score")
+}
+
+func loadUsersWithPolicy(t *testing.T, dir string, policy input.DuplicatePolicy) (map[string]TestUser, error) {
+	t.Helper()
+	return input.LoadCSVDirectoryToMapWithOptions(dir, func(u TestUser) string { return u.ID },
+		input.LoadOptions{Duplicates: policy})
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_DuplicateFirstWins(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "file1.csv", []byte("id,email,score\n1,a@x.com,100\n"))
+	testutils.CreateMockFile(t, dir, "file2.csv", []byte("id,email,score\n1,override@x.com,999\n"))
+
+	records, err := loadUsersWithPolicy(t, dir, input.DuplicateFirstWins)
+	require.NoError(t, err)
+	assert.Equal(t, "a@x.com", records["1"].Email)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_DuplicateError(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	file1 := testutils.CreateMockFile(t, dir, "file1.csv", []byte("id,email,score\n1,a@x.com,100\n2,b@x.com,1\n1,again@x.com,5\n"))
+	file2 := testutils.CreateMockFile(t, dir, "file2.csv", []byte("id,email,score\n3,c@x.com,3\n1,override@x.com,999\n3,c2@x.com,3\n"))
+
+	records, err := loadUsersWithPolicy(t, dir, input.DuplicateError)
+	require.Nil(t, records)
+
+	var dupErr *input.DuplicateKeyError
+	require.ErrorAs(t, err, &dupErr)
+	require.Equal(t, []input.DuplicateKey{
+		{Key: "1", Locations: []input.Location{{File: file1, Line: 2}, {File: file1, Line: 4}, {File: file2, Line: 3}}},
+		{Key: "3", Locations: []input.Location{{File: file2, Line: 2}, {File: file2, Line: 4}}},
+	}, dupErr.Duplicates)
+	assert.Contains(t, err.Error(), "2 duplicate key(s) found")
+	assert.Contains(t, err.Error(), `key "3" at `+file2+":2, "+file2+":4")
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_DuplicateMerge(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "file1.csv", []byte("id,email,score\n1,a@x.com,\n"))
+	testutils.CreateMockFile(t, dir, "file2.csv", []byte("id,email,score\n1,,42\n"))
+
+	records, err := loadUsersWithPolicy(t, dir, input.DuplicateMerge)
+	require.NoError(t, err)
+	assert.Equal(t, TestUser{ID: "1", Email: "a@x.com", Score: 42}, records["1"])
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_DuplicateMergeConflict(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "file1.csv", []byte("id,email,score\n1,a@x.com,1\n"))
+	testutils.CreateMockFile(t, dir, "file2.csv", []byte("id,email,score\n1,b@x.com,1\n"))
+
+	_, err := loadUsersWithPolicy(t, dir, input.DuplicateMerge)
+
+	var dupErr *input.DuplicateKeyError
+	require.ErrorAs(t, err, &dupErr)
+	require.Len(t, dupErr.Duplicates, 1)
+	assert.Equal(t, []string{"email"}, dupErr.Duplicates[0].Columns)
+	assert.Contains(t, err.Error(), "(conflicting columns: email)")
+}
+
+func TestLoadCSVDirectoryToMap_LoadsGzipFiles(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	testutils.CreateMockFile(t, dir, "a.csv", []byte("id,email,score\n1,a@x.com,1\n"))
+	testutils.CreateMockFile(t, dir, "b.csv.gz", gzipBytes(t, []byte("id,email,score\n2,b@x.com,2\n")))
+	testutils.CreateMockFile(t, dir, "c.txt.gz", gzipBytes(t, []byte("not csv")))
+
+	records, err := input.LoadCSVDirectoryToMap(dir, func(u TestUser) string { return u.ID })
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "b@x.com", records["2"].Email)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_FromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/users.csv":        {Data: []byte("id,email,score\n1,alice@example.com,100\n")},
+		"data/nested/more.csv":  {Data: []byte("id,email,score\n2,bob@example.com,80\n")},
+		"data/readme.md":        {Data: []byte("# not csv")},
+		"other/ignored_too.csv": {Data: []byte("id,email,score\n3,carol@example.com,70\n")},
+	}
+
+	opts := input.LoadOptions{Duplicates: input.DuplicateError}
+	opts.FS = fsys
+	records, err := input.LoadCSVDirectoryToMapWithOptions(
+		"data", func(u TestUser) string { return u.ID }, opts)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, 80, records["2"].Score)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_FromFSReportsFSPaths(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.csv": {Data: []byte("id,email,score\n1,alice@example.com,100\n")},
+		"b.csv": {Data: []byte("id,email,score\n1,alice@example.com,100\n")},
+	}
+
+	opts := input.LoadOptions{Duplicates: input.DuplicateError}
+	opts.FS = fsys
+	_, err := input.LoadCSVDirectoryToMapWithOptions(
+		".", func(u TestUser) string { return u.ID }, opts)
+	require.ErrorContains(t, err, `key "1" at a.csv:2, b.csv:2`)
+}
+
+// userFile returns a one-row users CSV for key 1 with the given email.
+func userFile(email string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte("id,email,score\n1," + email + ",1\n")}
+}
+
+func loadUsersFromFS(fsys fstest.MapFS, opts input.LoadOptions) (map[string]TestUser, error) {
+	opts.FS = fsys
+	return input.LoadCSVDirectoryToMapWithOptions(".", func(u TestUser) string { return u.Email }, opts)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_IncludeExcludeGlobs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"top.csv":                   userFile("top"),
+		"prod/users.csv":            userFile("prod"),
+		"prod/eu/users.csv":         userFile("prod-eu"),
+		"prod/eu/users.draft.csv":   userFile("prod-eu-draft"),
+		"prod/scratch/tmp.csv":      userFile("prod-scratch"),
+		"staging/users.csv":         userFile("staging"),
+		"prod/eu/users.tsv":         userFile("prod-eu-tsv"),
+		"prod/eu/notes.txt":         {Data: []byte("not csv")},
+		"prod/scratch/deep/old.csv": userFile("prod-scratch-deep"),
+	}
+
+	records, err := loadUsersFromFS(fsys, input.LoadOptions{
+		IncludeGlobs: []string{"prod/**/*.csv", "**/*.tsv"},
+		ExcludeGlobs: []string{"**/scratch", "**/*.draft.csv"},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"prod", "prod-eu", "prod-eu-tsv"}, keysOf(records))
+
+	records, err = loadUsersFromFS(fsys, input.LoadOptions{ExcludeGlobs: []string{"prod/**"}})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"top", "staging"}, keysOf(records))
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_NonRecursive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"top.csv":        userFile("top"),
+		"nested/sub.csv": userFile("nested"),
+	}
+
+	records, err := loadUsersFromFS(fsys, input.LoadOptions{NonRecursive: true})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"top"}, keysOf(records))
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_LoadOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"b.csv":   userFile("b"),
+		"a-b.csv": userFile("a-b"),
+		"a/z.csv": userFile("a/z"),
+	}
+
+	opts := input.LoadOptions{Duplicates: input.DuplicateError}
+	opts.FS = fsys
+	_, err := input.LoadCSVDirectoryToMapWithOptions(".", func(u TestUser) string { return u.ID }, opts)
+	require.ErrorContains(t, err, `key "1" at a/z.csv:2, a-b.csv:2, b.csv:2`)
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_InvalidGlob(t *testing.T) {
+	_, err := loadUsersFromFS(fstest.MapFS{}, input.LoadOptions{IncludeGlobs: []string{"[a-"}})
+	require.ErrorContains(t, err, `invalid glob pattern "[a-"`)
+}
+
+func TestLoadCSVDirectoryToMap_SingleFilePath(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "users.csv", []byte("id,email,score\n1,a@x.com,100\n"))
+
+	records, err := input.LoadCSVDirectoryToMap(path, func(u TestUser) string { return u.ID })
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+}
+
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestLoadCSVDirectoryToMapWithOptions_IgnoreUnset(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.csv": {Data: []byte("id,email\n1,alice@example.com\n2,bob@example.com\n")},
+		"b.csv": {Data: []byte("id,email,score\n3,-,70\n2,,80\n")},
+	}
+
+	unset := map[string][]string{}
+	opts := input.LoadOptions{
+		Duplicates: input.DuplicateMerge,
+		OnUnset:    func(key any, columns []string) { unset[key.(string)] = columns },
+	}
+	opts.FS = fsys
+	opts.IgnoreUnset = true
+	opts.UnsetSentinel = "-"
+	records, err := input.LoadCSVDirectoryToMapWithOptions(".", func(u TestUser) string { return u.ID }, opts)
+	require.NoError(t, err)
+	require.Equal(t, map[string]TestUser{
+		"1": {ID: "1", Email: "alice@example.com"},
+		"2": {ID: "2", Email: "bob@example.com", Score: 80},
+		"3": {ID: "3", Score: 70},
+	}, records)
+	require.Equal(t, map[string][]string{
+		"1": {"score"},
+		"3": {"email"},
+	}, unset, "merging key 2 sets score, so nothing is left unset")
+
+	// Without IgnoreUnset, missing columns are still an error.
+	opts.IgnoreUnset = false
+	_, err = input.LoadCSVDirectoryToMapWithOptions(".", func(u TestUser) string { return u.ID }, opts)
+	require.ErrorContains(t, err, "missing required column")
+}
@@ -0,0 +1,118 @@
+package input
+
+import (
+	"encoding/csv"
+	"io"
+	"io/fs"
+)
+
+// CSVOptions describes the CSV dialect of the files being read. The zero
+// value reads standard comma-separated UTF-8 files.
+type CSVOptions struct {
+	// Delimiter separates fields; zero means ','. Use '\t' for TSV or ';' for
+	// European Excel exports.
+	Delimiter rune
+
+	// Comment, if non-zero, marks lines to skip when it is their first
+	// character, e.g. '#'.
+	Comment rune
+
+	// LazyQuotes tolerates quotes in unquoted fields and non-doubled quotes
+	// in quoted fields.
+	LazyQuotes bool
+
+	// TrimLeadingSpace ignores leading white space in each field.
+	TrimLeadingSpace bool
+
+	// FieldsPerRecord follows encoding/csv: zero requires every row to have
+	// as many fields as the header, a positive value requires exactly that
+	// many, and a negative value allows rows of any length.
+	FieldsPerRecord int
+
+	// Encoding, if set, converts the file's bytes to UTF-8 before parsing,
+	// e.g. Latin1, UTF16 or a golang.org/x/text transform.
+	Encoding func(io.Reader) io.Reader
+}
+
+func (o CSVOptions) newReader(src io.Reader) *csv.Reader {
+	if o.Encoding != nil {
+		src = o.Encoding(src)
+	}
+	r := csv.NewReader(src)
+	if o.Delimiter != 0 {
+		r.Comma = o.Delimiter
+	}
+	r.Comment = o.Comment
+	r.LazyQuotes = o.LazyQuotes
+	r.TrimLeadingSpace = o.TrimLeadingSpace
+	r.FieldsPerRecord = o.FieldsPerRecord
+	return r
+}
+
+// DecodeOptions controls how a single CSV file is decoded.
+type DecodeOptions struct {
+	// Lenient keeps decoding after a bad row or cell. Rows with any bad cell
+	// are left out of the result, and every problem is returned together as
+	// DecodeErrors alongside the rows that did decode.
+	Lenient bool
+
+	// CaseInsensitiveHeaders matches headers to tag names and aliases
+	// ignoring case and surrounding or repeated whitespace, so "Email " and
+	// "email" are the same column.
+	CaseInsensitiveHeaders bool
+
+	// CSV describes the file dialect: delimiter, comments, quoting and
+	// character encoding.
+	CSV CSVOptions
+
+	// FS, if set, is the file system paths are opened in, e.g. an embed.FS,
+	// an fstest.MapFS or an archive opened with OpenArchive. Paths must then
+	// be valid fs.FS paths (slash-separated, unrooted, "." for the root).
+	// Nil means the operating system's file system.
+	FS fs.FS
+
+	// Interpolation, if set, expands `${NAME}` and `${secret:path}`
+	// references in string cells. Nil leaves cells untouched.
+	Interpolation *Interpolation
+
+	// IgnoreUnset lets files omit columns, for partial management of records
+	// co-owned with other systems: absent columns, and cells equal to
+	// UnsetSentinel when it is non-empty, are "unset". They decode like an
+	// empty cell (defaults apply) and are reported through
+	// LoadOptions.OnUnset so plan generation can take their values from the
+	// remote record instead.
+	IgnoreUnset   bool
+	UnsetSentinel string
+}
+
+// LoadOptions controls how a directory of CSV files is loaded.
+type LoadOptions struct {
+	DecodeOptions
+
+	// Duplicates decides what happens when a key appears on more than one
+	// row. The zero value (DuplicateLastWins) keeps the row read last.
+	Duplicates DuplicatePolicy
+
+	// IncludeGlobs, if non-empty, selects the files to load instead of the
+	// default `.csv`/`.csv.gz` filter, e.g. {"**/*.csv", "**/*.tsv"}.
+	// Patterns are matched against slash-separated paths relative to the
+	// loaded directory; "**" matches any number of directories.
+	IncludeGlobs []string
+
+	// ExcludeGlobs skips matching files and directories, e.g.
+	// {"scratch/**", "**/*.draft.csv"}. Exclusions win over IncludeGlobs.
+	ExcludeGlobs []string
+
+	// NonRecursive loads only the files directly inside the directory.
+	NonRecursive bool
+
+	// OnInterpolated, if set, is called once loading completes for every
+	// loaded key holding interpolated cells, with the raw template of each
+	// such cell keyed by column (see DecodeOptions.Interpolation).
+	OnInterpolated func(key any, templates map[string]string)
+
+	// OnUnset, if set, is called once loading completes for every loaded
+	// key with unset columns (see DecodeOptions.IgnoreUnset), listed in
+	// struct field order.
+	OnUnset func(key any, columns []string)
+}
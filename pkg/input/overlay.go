@@ -0,0 +1,259 @@
+package input
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// DefaultTombstoneColumn is the overlay column used to remove rows when
+// OverlayOptions.TombstoneColumn is empty.
+const DefaultTombstoneColumn = "_delete"
+
+// OverlayOptions controls how LoadCSVOverlaysToMap reads the base and overlay
+// directories.
+type OverlayOptions struct {
+	// LoadOptions applies to the base directory and, except for Lenient and
+	// Duplicates, to every overlay directory: file selection, dialect and FS
+	// are shared.
+	LoadOptions
+
+	// TombstoneColumn names the overlay column whose true cell ("true", "1",
+	// ...; see strconv.ParseBool) removes the row's key from the result.
+	// Empty means DefaultTombstoneColumn.
+	TombstoneColumn string
+}
+
+// LoadCSVOverlaysToMap loads baseDir like LoadCSVDirectoryToMapWithOptions
+// and then applies each overlay directory in order, so per-environment
+// differences can be kept apart from a shared base:
+//
+//	data/base/users.csv          id,email,quota     (every user)
+//	data/staging/users.csv       id,_delete         (users staging lacks)
+//	data/prod/quotas.csv         id,quota           (prod-specific quotas)
+//
+// Overlay files only need the key columns plus the columns they change. An
+// overlay file without every key column, or a row whose key cells are all
+// empty, is an error rather than a patch of the record with the empty key.
+// Key columns are the columns whose value keyFunc depends on.
+// For an overlay row whose key is already loaded, every column present in
+// the overlay file with a non-empty cell replaces the loaded value; empty
+// cells and absent columns keep it. A row whose tombstone cell is true
+// removes its key instead. A row with a new key adds a record, in which case
+// the overlay file must contain every required column of T.
+//
+// With IgnoreUnset, an overlay cell holding UnsetSentinel marks its column
+// unset for that key, a set cell clears it, and a new key may omit required
+// columns; OnUnset reports the merged result.
+//
+// Overlay files are always decoded strictly, and a key appearing in several
+// overlay rows is patched by each of them in file order. The result is the
+// merged desired state, ready for diff.ComputePlanDiff.
+//
+// Example usage:
+//
+//	users, err := LoadCSVOverlaysToMap("data/base", []string{"data/prod"},
+//	    func(u User) string { return u.ID }, OverlayOptions{})
+func LoadCSVOverlaysToMap[T any, K comparable](baseDir string, overlayDirs []string, keyFunc func(T) K, opts OverlayOptions) (map[K]T, error) {
+	baseOpts := opts.LoadOptions
+	var templates map[K]map[string]string
+	if opts.OnInterpolated != nil {
+		templates = map[K]map[string]string{}
+		baseOpts.OnInterpolated = func(key any, t map[string]string) {
+			templates[key.(K)] = t
+		}
+	}
+	var unset map[K][]string
+	if opts.OnUnset != nil {
+		unset = map[K][]string{}
+		baseOpts.OnUnset = func(key any, columns []string) {
+			unset[key.(K)] = columns
+		}
+	}
+
+	records, err := LoadCSVDirectoryToMapWithOptions(baseDir, keyFunc, baseOpts)
+	var baseErrs DecodeErrors
+	if err != nil && (records == nil || !errors.As(err, &baseErrs)) {
+		return nil, err
+	}
+
+	plan, err := buildFieldPlan(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	keyFields := keyColumns(plan, keyFunc)
+
+	tombstone := opts.TombstoneColumn
+	if tombstone == "" {
+		tombstone = DefaultTombstoneColumn
+	}
+	overlayOpts := opts.DecodeOptions
+	overlayOpts.Lenient = false
+
+	for _, dir := range overlayDirs {
+		files, err := discoverCSVFiles(dir, opts.LoadOptions)
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %w", dir, err)
+		}
+
+		for _, path := range files {
+			err := streamCSV(path, overlayOpts, &partialDecode{tombstoneColumn: tombstone}, func(patch T, row *rowInfo) error {
+				keySet := false
+				for _, i := range keyFields {
+					if !row.present[i] {
+						return fmt.Errorf("overlay file %s lacks key column %s", path, plan.Fields[i].Column)
+					}
+					keySet = keySet || row.set[i]
+				}
+				if len(keyFields) > 0 && !keySet {
+					return fmt.Errorf("%s: overlay row has an empty key", row.loc)
+				}
+				key := keyFunc(patch)
+
+				if row.tombstone != "" {
+					remove, err := strconv.ParseBool(row.tombstone)
+					if err != nil {
+						return &DecodeError{
+							File:   row.loc.File,
+							Line:   row.loc.Line,
+							Column: tombstone,
+							Value:  row.tombstone,
+							Err:    err,
+							kind:   "bool",
+						}
+					}
+					if remove {
+						delete(records, key)
+						delete(templates, key)
+						delete(unset, key)
+						return nil
+					}
+				}
+
+				base, exists := records[key]
+				if !exists {
+					rec, err := newOverlayRecord(plan, patch, row, opts.IgnoreUnset)
+					if err != nil {
+						return fmt.Errorf("%s: overlay adds key %v: %w", row.loc, key, err)
+					}
+					records[key] = rec
+					if templates != nil && row.templates != nil {
+						templates[key] = row.templates
+					}
+					if unset != nil && len(row.unset) > 0 {
+						unset[key] = row.unset
+					}
+					return nil
+				}
+
+				out := reflect.ValueOf(&base).Elem()
+				from := reflect.ValueOf(patch)
+				for i := range plan.Fields {
+					if row.set[i] {
+						f := &plan.Fields[i]
+						out.FieldByIndex(f.Index).Set(from.FieldByIndex(f.Index))
+						if t, ok := templates[key]; ok {
+							delete(t, f.Column)
+						}
+					}
+				}
+				if unset != nil {
+					unset[key] = patchUnset(plan, unset[key], row)
+					if len(unset[key]) == 0 {
+						delete(unset, key)
+					}
+				}
+				if templates != nil && row.templates != nil {
+					if templates[key] == nil {
+						templates[key] = map[string]string{}
+					}
+					for column, t := range row.templates {
+						templates[key][column] = t
+					}
+				}
+				records[key] = base
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for key, t := range templates {
+		if len(t) > 0 {
+			opts.OnInterpolated(key, t)
+		}
+	}
+	for key, columns := range unset {
+		opts.OnUnset(key, columns)
+	}
+	if len(baseErrs) > 0 {
+		return records, baseErrs
+	}
+	return records, nil
+}
+
+// keyColumns returns the indexes in plan.Fields of the columns keyFunc reads:
+// those that change the key of a zero record when set to "1". Columns that
+// cannot hold "1" are not detected.
+func keyColumns[T any, K comparable](plan *schema.Schema, keyFunc func(T) K) []int {
+	var zero T
+	empty := keyFunc(zero)
+	var columns []int
+	for i := range plan.Fields {
+		f := &plan.Fields[i]
+		var probe T
+		if err := f.Decode(reflect.ValueOf(&probe).Elem().FieldByIndex(f.Index), "1"); err != nil {
+			continue
+		}
+		if keyFunc(probe) != empty {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+// newOverlayRecord completes a record introduced by an overlay row, filling
+// unset columns from their `default` tag option. Every required column must
+// be present in the overlay file, unless ignoreUnset leaves it to the remote
+// record.
+func newOverlayRecord[T any](plan *schema.Schema, patch T, row *rowInfo, ignoreUnset bool) (T, error) {
+	out := reflect.ValueOf(&patch).Elem()
+	for i := range plan.Fields {
+		f := &plan.Fields[i]
+		if !f.Optional && !row.present[i] && !ignoreUnset {
+			return patch, fmt.Errorf("missing required column: %s", f.Column)
+		}
+		if !row.set[i] && f.Default != nil {
+			if err := f.Decode(out.FieldByIndex(f.Index), *f.Default); err != nil {
+				return patch, err
+			}
+		}
+	}
+	return patch, nil
+}
+
+// patchUnset returns the unset columns of a loaded record after an overlay
+// row patched it: columns the row sets are no longer unset, and columns the
+// row marks with the unset sentinel become unset. Absent columns keep their
+// state.
+func patchUnset(plan *schema.Schema, unset []string, row *rowInfo) []string {
+	var out []string
+	for i := range plan.Fields {
+		column := plan.Fields[i].Column
+		switch {
+		case row.set[i]:
+		case row.present[i] && slices.Contains(row.unset, column):
+			out = append(out, column)
+		case slices.Contains(unset, column):
+			out = append(out, column)
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package input_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/stretchr/testify/require"
+)
+
+type QuotaUser struct {
+	ID    string `csv:"id"`
+	Email string `csv:"email"`
+	Quota int    `csv:"quota"`
+	Tier  string `csv:"tier,default=free"`
+}
+
+func loadOverlays(t *testing.T, fsys fstest.MapFS, overlays []string, opts input.OverlayOptions) (map[string]QuotaUser, error) {
+	t.Helper()
+	opts.FS = fsys
+	return input.LoadCSVOverlaysToMap("base", overlays, func(u QuotaUser) string { return u.ID }, opts)
+}
+
+func TestLoadCSVOverlaysToMap_PatchesRemovesAndAdds(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv": {Data: []byte("id,email,quota,tier\n" +
+			"1,alice@example.com,10,pro\n" +
+			"2,bob@example.com,10,\n" +
+			"3,carol@example.com,10,\n")},
+		"prod/quotas.csv":   {Data: []byte("id,quota,email\n1,100,\n2,,bob@prod.example.com\n")},
+		"prod/new.csv":      {Data: []byte("id,email,quota\n4,dan@example.com,5\n")},
+		"prod/removed.csv":  {Data: []byte("id,_delete\n3,true\n2,false\n")},
+		"prod2/quotas.csv":  {Data: []byte("id,quota\n1,200\n")},
+		"staging/users.csv": {Data: []byte("id,_delete\n1,1\n")},
+	}
+
+	records, err := loadOverlays(t, fsys, []string{"prod", "prod2"}, input.OverlayOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]QuotaUser{
+		"1": {ID: "1", Email: "alice@example.com", Quota: 200, Tier: "pro"},
+		"2": {ID: "2", Email: "bob@prod.example.com", Quota: 10, Tier: "free"},
+		"4": {ID: "4", Email: "dan@example.com", Quota: 5, Tier: "free"},
+	}, records)
+
+	records, err = loadOverlays(t, fsys, []string{"staging"}, input.OverlayOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.NotContains(t, records, "1")
+}
+
+func TestLoadCSVOverlaysToMap_RequiresKeys(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv":   {Data: []byte("id,email,quota\n1,a@x.com,1\n")},
+		"nokey/quotas.csv": {Data: []byte("email,quota\na@x.com,5\n")},
+		"empty/quotas.csv": {Data: []byte("id,quota\n1,5\n,7\n")},
+	}
+
+	_, err := loadOverlays(t, fsys, []string{"nokey"}, input.OverlayOptions{})
+	require.EqualError(t, err, "overlay file nokey/quotas.csv lacks key column id")
+
+	_, err = loadOverlays(t, fsys, []string{"empty"}, input.OverlayOptions{})
+	require.EqualError(t, err, "empty/quotas.csv:3: overlay row has an empty key")
+}
+
+func TestLoadCSVOverlaysToMap_CustomTombstoneColumn(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv": {Data: []byte("id,email,quota\n1,a@x.com,1\n2,b@x.com,2\n")},
+		"env/users.csv":  {Data: []byte("id,removed\n2,yes\n")},
+	}
+
+	_, err := loadOverlays(t, fsys, []string{"env"}, input.OverlayOptions{TombstoneColumn: "removed"})
+	require.ErrorContains(t, err, "invalid bool value for field 'removed' at row 2")
+
+	fsys["env/users.csv"] = &fstest.MapFile{Data: []byte("id,removed\n2,TRUE\n")}
+	records, err := loadOverlays(t, fsys, []string{"env"}, input.OverlayOptions{TombstoneColumn: "removed"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+}
+
+func TestLoadCSVOverlaysToMap_NewKeyNeedsRequiredColumns(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv": {Data: []byte("id,email,quota\n1,a@x.com,1\n")},
+		"env/quotas.csv": {Data: []byte("id,quota\n9,50\n")},
+	}
+
+	_, err := loadOverlays(t, fsys, []string{"env"}, input.OverlayOptions{})
+	require.ErrorContains(t, err, "env/quotas.csv:2: overlay adds key 9: missing required column: email")
+}
+
+func TestLoadCSVOverlaysToMap_OverlayDecodeError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv": {Data: []byte("id,email,quota\n1,a@x.com,1\n")},
+		"env/quotas.csv": {Data: []byte("id,quota\n1,lots\n")},
+	}
+
+	_, err := loadOverlays(t, fsys, []string{"env"}, input.OverlayOptions{})
+	var decodeErr *input.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	require.Equal(t, "quota", decodeErr.Column)
+}
+
+func TestLoadCSVOverlaysToMap_IgnoreUnset(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/users.csv": {Data: []byte("id,email\n1,a@x.com\n2,b@x.com\n")},
+		"env/quotas.csv": {Data: []byte("id,quota,email\n1,5,\n2,,?\n3,7,\n")},
+	}
+
+	unset := map[string][]string{}
+	opts := input.OverlayOptions{}
+	opts.IgnoreUnset = true
+	opts.UnsetSentinel = "?"
+	opts.OnUnset = func(key any, columns []string) { unset[key.(string)] = columns }
+	records, err := loadOverlays(t, fsys, []string{"env"}, opts)
+	require.NoError(t, err)
+	require.Equal(t, map[string]QuotaUser{
+		"1": {ID: "1", Email: "a@x.com", Quota: 5, Tier: "free"},
+		"2": {ID: "2", Email: "b@x.com", Tier: "free"},
+		"3": {ID: "3", Quota: 7, Tier: "free"},
+	}, records)
+	require.Equal(t, map[string][]string{
+		"1": {"tier"},
+		"2": {"email", "quota", "tier"},
+		"3": {"tier"},
+	}, unset, "an empty cell sets the column, only absent columns and the sentinel leave it unset")
+}
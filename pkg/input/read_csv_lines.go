@@ -1,20 +1,29 @@
 package input
 
 import (
+	"compress/gzip"
 	"encoding/csv"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"strings"
 )
 
 // ReadCSVLines reads a CSV file and returns all rows as a slice of string slices.
 func ReadCSVLines(filePath string) ([][]string, error) {
-	f, err := os.Open(filePath)
+	return ReadCSVLinesWithOptions(filePath, CSVOptions{})
+}
+
+// ReadCSVLinesWithOptions is ReadCSVLines using the dialect described by opts.
+// Gzip-compressed files (ending in ".gz") are decompressed transparently.
+func ReadCSVLinesWithOptions(filePath string, opts CSVOptions) ([][]string, error) {
+	r, closeFile, err := openCSVReader(nil, filePath, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open CSV file %s: %w", filePath, err)
+		return nil, err
 	}
-	defer f.Close()
+	defer closeFile()
 
-	r := csv.NewReader(f)
 	records, err := r.ReadAll()
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse CSV file %s: %w", filePath, err)
@@ -26,3 +35,41 @@ func ReadCSVLines(filePath string) ([][]string, error) {
 
 	return records, nil
 }
+
+// openCSVReader opens filePath in fsys (or the OS file system when fsys is
+// nil), decompressing ".gz" files, and returns a CSV reader configured by
+// opts along with a function closing the file.
+func openCSVReader(fsys fs.FS, filePath string, opts CSVOptions) (*csv.Reader, func(), error) {
+	var f io.ReadCloser
+	var err error
+	if fsys != nil {
+		f, err = fsys.Open(filePath)
+	} else {
+		f, err = os.Open(filePath)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open CSV file %s: %w", filePath, err)
+	}
+
+	var src io.Reader = f
+	closeFile := func() { f.Close() }
+	if strings.HasSuffix(filePath, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("failed to decompress CSV file %s: %w", filePath, err)
+		}
+		src = gz
+		closeFile = func() {
+			gz.Close()
+			f.Close()
+		}
+	}
+
+	return opts.newReader(src), closeFile, nil
+}
+
+// isCSVFile reports whether path names a plain or gzip-compressed CSV file.
+func isCSVFile(path string) bool {
+	return strings.HasSuffix(path, ".csv") || strings.HasSuffix(path, ".csv.gz")
+}
@@ -1,6 +1,8 @@
 package input_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"testing"
 
 	"github.com/algebananazzzzz/planear/pkg/input"
@@ -52,3 +54,57 @@ func TestReadCSVLines_InvalidCSVFormat(t *testing.T) {
 	require.Contains(t, err.Error(), "failed to parse CSV file")
 	require.Nil(t, records)
 }
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadCSVLinesWithOptions_Dialect(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("# exported 2024-01-01\nid;name\n1; Alice\n2;Bo\"b\n")
+	path := testutils.CreateMockFile(t, dir, "semicolon.csv", content)
+
+	records, err := input.ReadCSVLinesWithOptions(path, input.CSVOptions{
+		Delimiter:        ';',
+		Comment:          '#',
+		LazyQuotes:       true,
+		TrimLeadingSpace: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"id", "name"}, {"1", "Alice"}, {"2", "Bo\"b"}}, records)
+}
+
+func TestReadCSVLinesWithOptions_FieldsPerRecord(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "ragged.csv", []byte("id,name\n1\n"))
+
+	_, err := input.ReadCSVLines(path)
+	require.ErrorContains(t, err, "wrong number of fields")
+
+	records, err := input.ReadCSVLinesWithOptions(path, input.CSVOptions{FieldsPerRecord: -1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, records[1])
+}
+
+func TestReadCSVLinesWithOptions_Gzip(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "data.csv.gz", gzipBytes(t, []byte("id,name\n1,Alice\n")))
+
+	records, err := input.ReadCSVLines(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "Alice"}, records[1])
+}
+
+func TestReadCSVLinesWithOptions_InvalidGzip(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "broken.csv.gz", []byte("id,name\n"))
+
+	_, err := input.ReadCSVLines(path)
+	require.ErrorContains(t, err, "failed to decompress CSV file")
+}
@@ -0,0 +1,307 @@
+package input
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// StreamCSVFile decodes a CSV file row by row into records of type T and calls
+// fn with each record and its location, without holding the file in memory.
+// It accepts the same struct tags and DecodeOptions as DecodeCSVFile; the
+// reflected field plan is built once and reused for every row, and the CSV
+// reader's row buffer is recycled.
+//
+// Returning an error from fn stops the stream and returns that error as-is.
+// In strict mode the first decode problem stops the stream; in lenient mode
+// rows with bad cells are skipped and every problem is returned together as
+// DecodeErrors once the file has been read.
+//
+// Example usage:
+//
+//	err := StreamCSVFile("users.csv.gz", DecodeOptions{}, func(u User, loc Location) error {
+//	    return sink.Write(u)
+//	})
+func StreamCSVFile[T any](filePath string, opts DecodeOptions, fn func(T, Location) error) error {
+	return streamCSV(filePath, opts, nil, func(rec T, row *rowInfo) error {
+		return fn(rec, row.loc)
+	})
+}
+
+// partialDecode switches streamCSV to decoding partial rows, as found in
+// overlay files: every column is optional and defaults are not applied.
+type partialDecode struct {
+	tombstoneColumn string // header whose cell marks a row for removal
+}
+
+// rowInfo describes a decoded row beyond the record itself.
+type rowInfo struct {
+	loc       Location
+	templates map[string]string // raw cell of each interpolated column
+	unset     []string          // unset columns, with DecodeOptions.IgnoreUnset
+
+	// Set only when decoding partial rows.
+	present   []bool // per schema field: the column is in the header
+	set       []bool // per schema field: the column is present and the cell non-empty and not the unset sentinel
+	tombstone string // trimmed tombstone cell, "" when absent
+}
+
+// streamCSV is the streaming core shared by StreamCSVFile and the overlay
+// loader. partial, if non-nil, decodes partial rows and fills the
+// corresponding rowInfo fields.
+func streamCSV[T any](filePath string, opts DecodeOptions, partial *partialDecode, fn func(T, *rowInfo) error) error {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	plan, err := buildFieldPlan(typ)
+	if err != nil {
+		return err
+	}
+
+	// loadErr reports a problem with the file as a whole.
+	loadErr := func(err error) error {
+		if opts.Lenient {
+			return DecodeErrors{{File: filePath, Err: err}}
+		}
+		return fmt.Errorf("error loading data file: %w", err)
+	}
+
+	r, closeFile, err := openCSVReader(opts.FS, filePath, opts.CSV)
+	if err != nil {
+		return loadErr(err)
+	}
+	defer closeFile()
+	r.ReuseRecord = true
+
+	headers, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return loadErr(fmt.Errorf("empty CSV file: %s", filePath))
+	}
+	if err != nil {
+		return loadErr(fmt.Errorf("failed to parse CSV file %s: %w", filePath, err))
+	}
+
+	headerMap, normalize := indexHeaders(headers, opts)
+	columns, errs := resolveColumns(filePath, headerMap, normalize, plan, partial != nil || opts.IgnoreUnset)
+	if len(errs) > 0 {
+		if opts.Lenient {
+			return errs
+		}
+		return errs[0]
+	}
+
+	decoder := &rowDecoder{
+		plan:         plan,
+		columns:      columns,
+		filePath:     filePath,
+		withDefaults: partial == nil,
+		interp:       opts.Interpolation,
+	}
+	if opts.IgnoreUnset {
+		decoder.sentinel = opts.UnsetSentinel
+	}
+	info := &rowInfo{}
+	tombstoneIndex := -1
+	if partial != nil {
+		info.present = make([]bool, len(columns))
+		info.set = make([]bool, len(columns))
+		for i, c := range columns {
+			info.present[i] = c >= 0
+		}
+		if i, ok := headerMap[normalize(partial.tombstoneColumn)]; ok {
+			tombstoneIndex = i
+		}
+	}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to parse CSV file %s: %w", filePath, err)
+			if !opts.Lenient {
+				return fmt.Errorf("error loading data file: %w", err)
+			}
+			var parseErr *csv.ParseError
+			line := 0
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+			}
+			// The reader cannot reliably resynchronise after a parse error,
+			// so the rest of the file is abandoned.
+			errs = append(errs, &DecodeError{File: filePath, Line: line, Err: err})
+			break
+		}
+		line, _ := r.FieldPos(0)
+
+		rec, templates, rowErrs := decodeRow[T](decoder, row, line)
+		if len(rowErrs) > 0 {
+			if !opts.Lenient {
+				return rowErrs[0]
+			}
+			errs = append(errs, rowErrs...)
+			continue
+		}
+
+		info.loc = Location{File: filePath, Line: line}
+		info.templates = templates
+		if opts.IgnoreUnset {
+			info.unset = nil
+			for i, c := range columns {
+				if c < 0 || decoder.isSentinel(row, c) {
+					info.unset = append(info.unset, plan.Fields[i].Column)
+				}
+			}
+		}
+		if partial != nil {
+			for i, c := range columns {
+				info.set[i] = c >= 0 && c < len(row) && strings.TrimSpace(row[c]) != "" && !decoder.isSentinel(row, c)
+			}
+			info.tombstone = ""
+			if tombstoneIndex >= 0 && tombstoneIndex < len(row) {
+				info.tombstone = strings.TrimSpace(row[tombstoneIndex])
+			}
+		}
+		if err := fn(rec, info); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// rowDecoder holds what decodeRow needs to turn a CSV row into a record.
+type rowDecoder struct {
+	plan         *schema.Schema
+	columns      []int // header position of each plan field, -1 if absent
+	filePath     string
+	withDefaults bool           // fill empty cells from `default` tag options
+	interp       *Interpolation // expand ${...} references, if non-nil
+	sentinel     string         // cell value decoded as empty, if non-empty
+}
+
+// isSentinel reports whether cell c of row holds the unset sentinel.
+func (d *rowDecoder) isSentinel(row []string, c int) bool {
+	return d.sentinel != "" && c >= 0 && c < len(row) && strings.TrimSpace(row[c]) == d.sentinel
+}
+
+// decodeRow decodes one CSV row. It returns the raw template of every cell
+// that Interpolation expanded, keyed by column. On failure it returns one
+// DecodeError per bad cell, each carrying the partially decoded record, in
+// which interpolated cells hold their templates rather than the resolved
+// values: the templates of a failed row are not passed on, so its record
+// may be printed or stored as is.
+func decodeRow[T any](d *rowDecoder, row []string, line int) (T, map[string]string, DecodeErrors) {
+	var rec T
+	entry := reflect.ValueOf(&rec).Elem()
+	var templates map[string]string
+	var rowErrs DecodeErrors
+	for i := range d.plan.Fields {
+		f := &d.plan.Fields[i]
+		rawValue := ""
+		if d.columns[i] >= 0 && d.columns[i] < len(row) {
+			rawValue = strings.TrimSpace(row[d.columns[i]])
+		}
+		if d.sentinel != "" && rawValue == d.sentinel {
+			rawValue = ""
+		}
+		if rawValue == "" && f.Default != nil && d.withDefaults {
+			rawValue = *f.Default
+		}
+		if d.interp != nil && f.IsText() {
+			expanded, resolved, err := d.interp.expand(rawValue)
+			if err != nil {
+				rowErrs = append(rowErrs, &DecodeError{
+					File:   d.filePath,
+					Line:   line,
+					Column: f.Column,
+					Value:  rawValue,
+					Err:    fmt.Errorf("interpolating field '%s': %w", f.Column, err),
+				})
+				continue
+			}
+			if resolved {
+				if templates == nil {
+					templates = map[string]string{}
+				}
+				templates[f.Column] = rawValue
+				rawValue = expanded
+			}
+		}
+		if err := f.Decode(entry.FieldByIndex(f.Index), rawValue); err != nil {
+			rowErrs = append(rowErrs, &DecodeError{
+				File:   d.filePath,
+				Line:   line,
+				Column: f.Column,
+				Value:  rawValue,
+				Err:    err,
+				kind:   f.TypeName,
+			})
+		}
+	}
+	if len(rowErrs) > 0 {
+		for column, t := range templates {
+			f, _ := d.plan.Field(column)
+			_ = f.Decode(entry.FieldByIndex(f.Index), t)
+		}
+		partial := entry.Interface()
+		for _, e := range rowErrs {
+			e.Record = partial
+		}
+	}
+	return rec, templates, rowErrs
+}
+
+// indexHeaders maps each header to its position. A UTF-8 byte order mark on
+// the first header is ignored. The returned normalize function must be
+// applied to names looked up in the map.
+func indexHeaders(headers []string, opts DecodeOptions) (map[string]int, func(string) string) {
+	normalize := func(h string) string { return h }
+	if opts.CaseInsensitiveHeaders {
+		normalize = func(h string) string { return strings.ToLower(strings.Join(strings.Fields(h), " ")) }
+	}
+
+	headerMap := map[string]int{}
+	for i, h := range headers {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		headerMap[normalize(h)] = i
+	}
+	return headerMap, normalize
+}
+
+// resolveColumns maps each field of plan to its column index in the header
+// map, trying the tag name and then each alias. Optional fields whose column
+// is absent map to -1; any other absent column is reported as a DecodeError
+// unless allOptional is set.
+func resolveColumns(filePath string, headerMap map[string]int, normalize func(string) string, plan *schema.Schema, allOptional bool) ([]int, DecodeErrors) {
+	var errs DecodeErrors
+	columns := make([]int, len(plan.Fields))
+	for i := range plan.Fields {
+		f := &plan.Fields[i]
+		columns[i] = -1
+		for _, name := range append([]string{f.Column}, f.Aliases...) {
+			if colIndex, ok := headerMap[normalize(name)]; ok {
+				columns[i] = colIndex
+				break
+			}
+		}
+		if columns[i] < 0 && !f.Optional && !allOptional {
+			errs = append(errs, &DecodeError{
+				File:   filePath,
+				Line:   1,
+				Column: f.Column,
+				Err:    fmt.Errorf("missing required column: %s", f.Column),
+			})
+		}
+	}
+	return columns, errs
+}
@@ -0,0 +1,181 @@
+package input_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/input"
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCSVFile_YieldsRecordsWithLocations(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,name,age\n1,Alice,30\n2,\"Bob\nSmith\",25\n3,Carol,41\n")
+	path := testutils.CreateMockFile(t, dir, "users.csv", content)
+
+	var records []SimpleRecord
+	var lines []int
+	err := input.StreamCSVFile(path, input.DecodeOptions{}, func(rec SimpleRecord, loc input.Location) error {
+		require.Equal(t, path, loc.File)
+		records = append(records, rec)
+		lines = append(lines, loc.Line)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []SimpleRecord{
+		{ID: "1", Name: "Alice", Age: 30},
+		{ID: "2", Name: "Bob\nSmith", Age: 25},
+		{ID: "3", Name: "Carol", Age: 41},
+	}, records)
+	// The quoted cell spans two lines, so Carol starts on line 5.
+	require.Equal(t, []int{2, 3, 5}, lines)
+}
+
+func TestStreamCSVFile_CallbackErrorStopsStream(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,name,age\n1,Alice,30\n2,Bob,25\n")
+	path := testutils.CreateMockFile(t, dir, "users.csv", content)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := input.StreamCSVFile(path, input.DecodeOptions{}, func(SimpleRecord, input.Location) error {
+		calls++
+		return stop
+	})
+	require.Same(t, stop, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestStreamCSVFile_StrictStopsAtBadRow(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,name,age\n1,Alice,30\n2,Bob,old\n3,Carol,41\n")
+	path := testutils.CreateMockFile(t, dir, "users.csv", content)
+
+	calls := 0
+	err := input.StreamCSVFile(path, input.DecodeOptions{}, func(SimpleRecord, input.Location) error {
+		calls++
+		return nil
+	})
+	var decodeErr *input.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	require.Equal(t, 3, decodeErr.Line)
+	require.Equal(t, 1, calls)
+}
+
+func TestStreamCSVFile_LenientReportsMalformedRow(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	content := []byte("id,name,age\n1,Alice,30\n2,\"Bob,25\n")
+	path := testutils.CreateMockFile(t, dir, "users.csv", content)
+
+	var records []SimpleRecord
+	err := input.StreamCSVFile(path, input.DecodeOptions{Lenient: true}, func(rec SimpleRecord, _ input.Location) error {
+		records = append(records, rec)
+		return nil
+	})
+	var decodeErrs input.DecodeErrors
+	require.ErrorAs(t, err, &decodeErrs)
+	require.Len(t, decodeErrs, 1)
+	require.Equal(t, 3, decodeErrs[0].Line)
+	require.Contains(t, decodeErrs[0].Error(), "failed to parse CSV file")
+	require.Len(t, records, 1)
+}
+
+func TestStreamCSVFile_EmptyFile_Error(t *testing.T) {
+	dir := testutils.NewTestDir(t)
+	path := testutils.CreateMockFile(t, dir, "empty.csv", []byte{})
+
+	err := input.StreamCSVFile(path, input.DecodeOptions{}, func(SimpleRecord, input.Location) error {
+		return nil
+	})
+	require.ErrorContains(t, err, "empty CSV file")
+}
+
+// writeBenchmarkCSV writes a CSV file with n SimpleRecord rows.
+func writeBenchmarkCSV(b *testing.B, n int) string {
+	b.Helper()
+	var sb strings.Builder
+	sb.WriteString("id,name,age\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%d,user-%d,%d\n", i, i, i%90)
+	}
+	path := filepath.Join(b.TempDir(), "bench.csv")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkLoadThenDecodeCSV measures the previous loading path, kept here
+// for comparison: every row is read into memory with ReadCSVLines, then
+// decoded into a slice field by field, as DecodeCSVFile used to.
+func BenchmarkLoadThenDecodeCSV(b *testing.B) {
+	path := writeBenchmarkCSV(b, 10000)
+	s, err := schema.Of[SimpleRecord]()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lines, err := input.ReadCSVLines(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		columns := map[string]int{}
+		for c, header := range lines[0] {
+			columns[header] = c
+		}
+		records := make([]SimpleRecord, 0, len(lines)-1)
+		for _, row := range lines[1:] {
+			var rec SimpleRecord
+			v := reflect.ValueOf(&rec).Elem()
+			for j := range s.Fields {
+				f := &s.Fields[j]
+				if err := f.Decode(v.FieldByIndex(f.Index), strings.TrimSpace(row[columns[f.Column]])); err != nil {
+					b.Fatal(err)
+				}
+			}
+			records = append(records, rec)
+		}
+		if len(records) != 10000 {
+			b.Fatal(len(records))
+		}
+	}
+}
+
+// BenchmarkDecodeCSVFile measures the current loading path into a slice,
+// the counterpart of BenchmarkLoadThenDecodeCSV.
+func BenchmarkDecodeCSVFile(b *testing.B) {
+	path := writeBenchmarkCSV(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, err := input.DecodeCSVFile[SimpleRecord](path)
+		if err != nil || len(records) != 10000 {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamCSVFile(b *testing.B) {
+	path := writeBenchmarkCSV(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		err := input.StreamCSVFile(path, input.DecodeOptions{}, func(SimpleRecord, input.Location) error {
+			count++
+			return nil
+		})
+		if err != nil || count != 10000 {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Package keys builds the string keys planear uses to match local and remote
+// records when a record is identified by more than one column.
+//
+// Concatenating the columns by hand ("alice" + ":" + "admin") lets distinct
+// records collide as soon as a column contains the separator: ("a:b", "c")
+// and ("a", "b:c") both become "a:b:c". Join escapes the separator and the
+// escape character in every part, so each list of parts has its own key,
+// and Split recovers the parts.
+//
+// # Usage
+//
+//	type RoleAssignment struct {
+//	    UserID   string `csv:"user_id"`
+//	    RoleName string `csv:"role"`
+//	}
+//
+//	key, err := keys.Columns[RoleAssignment]("user_id", "role")
+//	if err != nil {
+//	    return err
+//	}
+//	params.ExtractKeyFunc = key
+//
+// LoadRemoteRecords must key its map the same way, e.g. with keys.Join(userID,
+// roleName) or with the same Columns function.
+package keys
@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+const (
+	// Separator separates the parts of a composite key.
+	Separator = ':'
+	// Escape precedes a literal Separator or Escape within a part.
+	Escape = '\\'
+)
+
+// Join returns the composite key of parts: the parts joined by Separator,
+// each with Separator and Escape escaped. Distinct lists of parts always
+// produce distinct keys: no parts give the empty key, and a single empty
+// part is written as a lone Escape.
+func Join(parts ...string) string {
+	if len(parts) == 1 && parts[0] == "" {
+		return string(Escape)
+	}
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteByte(Separator)
+		}
+		writePart(&b, part)
+	}
+	return b.String()
+}
+
+// writePart writes part to b with Separator and Escape escaped.
+func writePart(b *strings.Builder, part string) {
+	for i := 0; i < len(part); i++ {
+		if c := part[i]; c == Separator || c == Escape {
+			b.WriteByte(Escape)
+		}
+		b.WriteByte(part[i])
+	}
+}
+
+// nilPart is the part Columns writes for a nil pointer. Join only escapes
+// Separator and Escape, so no value is written the same way.
+const nilPart = string(Escape) + "0"
+
+// Split returns the parts of a key produced by Join. A key ending in an
+// unpaired Escape, escaping any other character, or holding the part
+// Columns writes for a nil pointer is an error.
+func Split(key string) ([]string, error) {
+	switch key {
+	case "":
+		return []string{}, nil
+	case string(Escape):
+		return []string{""}, nil
+	}
+	var (
+		parts []string
+		b     strings.Builder
+	)
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case Escape:
+			if i+1 == len(key) {
+				return nil, fmt.Errorf("key %q ends with an unpaired escape character", key)
+			}
+			i++
+			switch key[i] {
+			case Separator, Escape:
+				b.WriteByte(key[i])
+			case nilPart[1]:
+				return nil, fmt.Errorf("key %q holds a nil value, which has no string part", key)
+			default:
+				return nil, fmt.Errorf("key %q escapes %q, which is neither the separator nor the escape character", key, key[i])
+			}
+		case Separator:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(parts, b.String()), nil
+}
+
+// Columns returns a function that builds the composite key of a record from
+// the listed `csv` columns, suitable for GenerateParams.ExtractKeyFunc.
+// Values are formatted with fmt.Sprint. A nil pointer is written as a part
+// no value produces, so it never collides with an empty value; Split
+// rejects such keys.
+// Columns that T does not map are an error.
+func Columns[T any](columns ...string) (func(T) string, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("at least one key column is required")
+	}
+	s, err := schema.Of[T]()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		f, ok := s.Field(column)
+		if !ok {
+			return nil, fmt.Errorf("key column %q is not a column of %s", column, s.Type)
+		}
+		indexes[i] = f.Index
+	}
+
+	return func(rec T) string {
+		v := reflect.ValueOf(rec)
+		var b strings.Builder
+		for i, index := range indexes {
+			if i > 0 {
+				b.WriteByte(Separator)
+			}
+			field := v.FieldByIndex(index)
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					b.WriteString(nilPart)
+					continue
+				}
+				field = field.Elem()
+			}
+			writePart(&b, format(field))
+		}
+		if b.Len() == 0 {
+			// A single empty part, written as Join writes it.
+			return string(Escape)
+		}
+		return b.String()
+	}, nil
+}
+
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,84 @@
+package keys_test
+
+import (
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/keys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoin_EscapesSeparator(t *testing.T) {
+	require.Equal(t, "alice:admin", keys.Join("alice", "admin"))
+	require.Equal(t, `a\:b:c`, keys.Join("a:b", "c"))
+	require.Equal(t, `a:b\:c`, keys.Join("a", "b:c"))
+	require.Equal(t, `a\\:b`, keys.Join(`a\`, "b"))
+	require.NotEqual(t, keys.Join(`a\`, "b"), keys.Join(`a\:b`))
+}
+
+func TestSplit_RoundTrips(t *testing.T) {
+	for _, parts := range [][]string{
+		{"alice", "admin"},
+		{"a:b", "c"},
+		{`a\`, `:b\:`},
+		{"", "", ""},
+		{"single"},
+		{""},
+		{},
+	} {
+		got, err := keys.Split(keys.Join(parts...))
+		require.NoError(t, err)
+		require.Equal(t, parts, got)
+	}
+
+	_, err := keys.Split(`a\`)
+	require.EqualError(t, err, `key "a\\" ends with an unpaired escape character`)
+	_, err = keys.Split(`a\b`)
+	require.EqualError(t, err, `key "a\\b" escapes 'b', which is neither the separator nor the escape character`)
+}
+
+func TestJoin_EmptyKeys(t *testing.T) {
+	require.Equal(t, "", keys.Join())
+	require.Equal(t, `\`, keys.Join(""))
+	require.Equal(t, ":", keys.Join("", ""))
+
+	parts, err := keys.Split("")
+	require.NoError(t, err)
+	require.Empty(t, parts)
+}
+
+type Assignment struct {
+	UserID string  `csv:"user_id"`
+	Role   string  `csv:"role"`
+	Level  *int    `csv:"level"`
+	Note   string  `csv:"note"`
+	Team   *string `csv:"team"`
+	Extra  float64 `csv:"-"`
+}
+
+func TestColumns(t *testing.T) {
+	key, err := keys.Columns[Assignment]("user_id", "role", "level")
+	require.NoError(t, err)
+
+	level := 3
+	require.Equal(t, "u1:ops\\:lead:3", key(Assignment{UserID: "u1", Role: "ops:lead", Level: &level}))
+	require.Equal(t, "u1:ops:\\0", key(Assignment{UserID: "u1", Role: "ops"}))
+	_, err = keys.Split(key(Assignment{UserID: "u1", Role: "ops"}))
+	require.EqualError(t, err, `key "u1:ops:\\0" holds a nil value, which has no string part`)
+
+	byTeam, err := keys.Columns[Assignment]("user_id", "team")
+	require.NoError(t, err)
+	empty := ""
+	require.NotEqual(t, byTeam(Assignment{UserID: "u1"}), byTeam(Assignment{UserID: "u1", Team: &empty}))
+	require.Equal(t, keys.Join("u1", ""), byTeam(Assignment{UserID: "u1", Team: &empty}))
+
+	single, err := keys.Columns[Assignment]("note")
+	require.NoError(t, err)
+	require.Equal(t, keys.Join(""), single(Assignment{}))
+	require.Equal(t, keys.Join("a:b"), single(Assignment{Note: "a:b"}))
+
+	_, err = keys.Columns[Assignment]("user_id", "Extra")
+	require.EqualError(t, err, `key column "Extra" is not a column of keys_test.Assignment`)
+
+	_, err = keys.Columns[Assignment]()
+	require.EqualError(t, err, "at least one key column is required")
+}
@@ -0,0 +1,250 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// equalFunc reports whether two values of a field are equal.
+type equalFunc func(a, b reflect.Value) bool
+
+// comparer reports the changes between two values of a field.
+type comparer func(oldField, newField reflect.Value, column string) []types.FieldChange
+
+// comparerFor picks the comparer for a field of type t. Slices and maps are
+// compared element by element; everything else as a whole. Values are
+// equal according to equalFor.
+func comparerFor(t reflect.Type, opts Options) (comparer, error) {
+	switch t.Kind() {
+	case reflect.Slice:
+		eq, err := equalFor(t.Elem(), opts)
+		if err != nil {
+			return compareSlice(deepEqual), err
+		}
+		return compareSlice(eq), nil
+	case reflect.Map:
+		eq, err := equalFor(t.Elem(), opts)
+		if err != nil {
+			return compareMap(deepEqual), err
+		}
+		return compareMap(eq), nil
+	default:
+		eq, err := equalFor(t, opts)
+		if err != nil {
+			return compareValue(deepEqual), err
+		}
+		return compareValue(eq), nil
+	}
+}
+
+// equalFor returns the equality of values of type t under the comparison
+// options in opts:
+//
+//   - fold: strings are equal ignoring case (Unicode case folding)
+//   - trim: strings are equal ignoring leading and trailing whitespace
+//   - tolerance=X: numbers are equal when they differ by at most X
+//   - nilempty: a nil pointer equals a pointer to the zero value
+//
+// Options apply to the elements of pointers, slices and maps. Without
+// options values are compared with reflect.DeepEqual. Nil and empty slices
+// and maps are always equal.
+func equalFor(t reflect.Type, opts Options) (equalFunc, error) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		elemEq, err := equalFor(t.Elem(), opts)
+		if err != nil {
+			return nil, err
+		}
+		nilEmpty := opts.Has("nilempty")
+		return func(a, b reflect.Value) bool {
+			switch {
+			case a.IsNil() && b.IsNil():
+				return true
+			case a.IsNil():
+				return nilEmpty && b.Elem().IsZero()
+			case b.IsNil():
+				return nilEmpty && a.Elem().IsZero()
+			}
+			return elemEq(a.Elem(), b.Elem())
+		}, nil
+
+	case reflect.Slice:
+		elemEq, err := equalFor(t.Elem(), opts)
+		if err != nil {
+			return nil, err
+		}
+		return func(a, b reflect.Value) bool {
+			if a.Len() != b.Len() {
+				return false
+			}
+			for i := 0; i < a.Len(); i++ {
+				if !elemEq(a.Index(i), b.Index(i)) {
+					return false
+				}
+			}
+			return true
+		}, nil
+
+	case reflect.Map:
+		elemEq, err := equalFor(t.Elem(), opts)
+		if err != nil {
+			return nil, err
+		}
+		return func(a, b reflect.Value) bool {
+			if a.Len() != b.Len() {
+				return false
+			}
+			for _, k := range a.MapKeys() {
+				bv := b.MapIndex(k)
+				if !bv.IsValid() || !elemEq(a.MapIndex(k), bv) {
+					return false
+				}
+			}
+			return true
+		}, nil
+
+	case reflect.String:
+		fold, trim := opts.Has("fold"), opts.Has("trim")
+		if !fold && !trim {
+			break
+		}
+		return func(a, b reflect.Value) bool {
+			x, y := a.String(), b.String()
+			if trim {
+				x, y = strings.TrimSpace(x), strings.TrimSpace(y)
+			}
+			if fold {
+				return strings.EqualFold(x, y)
+			}
+			return x == y
+		}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		raw, ok := opts["tolerance"]
+		if !ok {
+			break
+		}
+		tolerance, err := strconv.ParseFloat(raw, 64)
+		if err != nil || tolerance < 0 {
+			return nil, fmt.Errorf("invalid tolerance %q", raw)
+		}
+		return func(a, b reflect.Value) bool {
+			return math.Abs(toFloat(a)-toFloat(b)) <= tolerance
+		}, nil
+	}
+
+	for _, name := range []string{"fold", "trim"} {
+		if opts.Has(name) {
+			return nil, fmt.Errorf("option %s applies to strings, not %s", name, t)
+		}
+	}
+	if opts.Has("tolerance") {
+		return nil, fmt.Errorf("option tolerance applies to numbers, not %s", t)
+	}
+	return deepEqual, nil
+}
+
+func deepEqual(a, b reflect.Value) bool {
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func compareValue(eq equalFunc) comparer {
+	return func(oldField, newField reflect.Value, column string) []types.FieldChange {
+		if eq(oldField, newField) {
+			return nil
+		}
+		return []types.FieldChange{{
+			Field:    column,
+			OldValue: oldField.Interface(),
+			NewValue: newField.Interface(),
+		}}
+	}
+}
+
+// compareSlice reports each index whose element differs. Nil and empty
+// slices are treated as equal.
+func compareSlice(eq equalFunc) comparer {
+	return func(oldField, newField reflect.Value, column string) []types.FieldChange {
+		var changes []types.FieldChange
+		n := max(oldField.Len(), newField.Len())
+		for i := 0; i < n; i++ {
+			if i < oldField.Len() && i < newField.Len() && eq(oldField.Index(i), newField.Index(i)) {
+				continue
+			}
+			changes = append(changes, types.FieldChange{
+				Field:    fmt.Sprintf("%s[%d]", column, i),
+				OldValue: elemAt(oldField, i),
+				NewValue: elemAt(newField, i),
+			})
+		}
+		return changes
+	}
+}
+
+func elemAt(slice reflect.Value, i int) any {
+	if i >= slice.Len() {
+		return nil
+	}
+	return slice.Index(i).Interface()
+}
+
+// compareMap reports each key whose value differs, was added or was removed,
+// in sorted key order. Nil and empty maps are treated as equal.
+func compareMap(eq equalFunc) comparer {
+	return func(oldField, newField reflect.Value, column string) []types.FieldChange {
+		keys := map[string]reflect.Value{}
+		for _, k := range oldField.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, k := range newField.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var changes []types.FieldChange
+		for _, name := range names {
+			oldElem := oldField.MapIndex(keys[name])
+			newElem := newField.MapIndex(keys[name])
+			if oldElem.IsValid() && newElem.IsValid() && eq(oldElem, newElem) {
+				continue
+			}
+			changes = append(changes, types.FieldChange{
+				Field:    fmt.Sprintf("%s[%s]", column, name),
+				OldValue: entryValue(oldElem),
+				NewValue: entryValue(newElem),
+			})
+		}
+		return changes
+	}
+}
+
+func entryValue(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,184 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// setDecoder picks the decoder for the field's type. Scalars are strings,
+// ints and floats; pointers to scalars decode empty cells as nil; slices and maps of
+// scalars honour the `split` (default ",") and `kv` (default ";=") options
+// respectively.
+func (f *Field) setDecoder() error {
+	t := f.Type
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		parse, typeName, ok := scalarParser(t.Elem())
+		if !ok {
+			return fmt.Errorf("unsupported pointer element type for field '%s'", f.Column)
+		}
+		f.TypeName = typeName
+		f.decode = func(field reflect.Value, raw string) error {
+			if raw == "" {
+				field.Set(reflect.Zero(t))
+				return nil
+			}
+			v, err := parse(raw)
+			if err != nil {
+				return err
+			}
+			ptr := reflect.New(t.Elem())
+			ptr.Elem().Set(v)
+			field.Set(ptr)
+			return nil
+		}
+
+	case reflect.Slice:
+		parse, _, ok := scalarParser(t.Elem())
+		if !ok {
+			return fmt.Errorf("unsupported slice element type for field '%s'", f.Column)
+		}
+		sep := f.Options["split"]
+		if sep == "" {
+			sep = ","
+		}
+		f.TypeName = "list"
+		f.decode = func(field reflect.Value, raw string) error {
+			if raw == "" {
+				field.Set(reflect.Zero(t))
+				return nil
+			}
+			out := reflect.MakeSlice(t, 0, strings.Count(raw, sep)+1)
+			for _, item := range strings.Split(raw, sep) {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					continue
+				}
+				v, err := parse(item)
+				if err != nil {
+					return fmt.Errorf("element %q: %w", item, err)
+				}
+				out = reflect.Append(out, v)
+			}
+			field.Set(out)
+			return nil
+		}
+
+	case reflect.Map:
+		parseKey, _, keyOK := scalarParser(t.Key())
+		parseValue, _, valueOK := scalarParser(t.Elem())
+		if !keyOK || !valueOK {
+			return fmt.Errorf("unsupported map key or value type for field '%s'", f.Column)
+		}
+		pairSep, kvSep, err := parseKVOption(f.Options["kv"])
+		if err != nil {
+			return fmt.Errorf("map field '%s': %w", f.Column, err)
+		}
+		f.TypeName = "map"
+		f.decode = func(field reflect.Value, raw string) error {
+			if raw == "" {
+				field.Set(reflect.Zero(t))
+				return nil
+			}
+			out := reflect.MakeMap(t)
+			for _, pair := range strings.Split(raw, pairSep) {
+				pair = strings.TrimSpace(pair)
+				if pair == "" {
+					continue
+				}
+				k, v, found := strings.Cut(pair, kvSep)
+				if !found {
+					return fmt.Errorf("pair %q is missing %q", pair, kvSep)
+				}
+				key, err := parseKey(strings.TrimSpace(k))
+				if err != nil {
+					return fmt.Errorf("key %q: %w", k, err)
+				}
+				value, err := parseValue(strings.TrimSpace(v))
+				if err != nil {
+					return fmt.Errorf("value for key %q: %w", k, err)
+				}
+				out.SetMapIndex(key, value)
+			}
+			field.Set(out)
+			return nil
+		}
+
+	default:
+		parse, typeName, ok := scalarParser(t)
+		if !ok {
+			return fmt.Errorf("unsupported field type '%s' for field '%s'", t.Kind().String(), f.Column)
+		}
+		f.TypeName = typeName
+		f.decode = func(field reflect.Value, raw string) error {
+			v, err := parse(raw)
+			if err != nil {
+				return err
+			}
+			field.Set(v)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// scalarParser returns a parser producing a value of type t from a cell.
+// Empty cells parse to the zero value.
+func scalarParser(t reflect.Type) (func(string) (reflect.Value, error), string, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return func(raw string) (reflect.Value, error) {
+			return reflect.ValueOf(raw).Convert(t), nil
+		}, "string", true
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return func(raw string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			if raw == "" {
+				return v, nil
+			}
+			intVal, err := strconv.Atoi(raw)
+			if err != nil {
+				return v, err
+			}
+			v.SetInt(int64(intVal))
+			return v, nil
+		}, "int", true
+	case reflect.Float32, reflect.Float64:
+		return func(raw string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			if raw == "" {
+				return v, nil
+			}
+			floatVal, err := strconv.ParseFloat(raw, t.Bits())
+			if err != nil {
+				return v, err
+			}
+			v.SetFloat(floatVal)
+			return v, nil
+		}, "float", true
+	}
+	return nil, "", false
+}
+
+// parseKVOption interprets the `kv` tag option: its first rune separates
+// pairs and its second separates a key from its value, so `kv=;=` decodes
+// "env=prod;tier=web". An empty option defaults to ";=".
+func parseKVOption(opt string) (string, string, error) {
+	if opt == "" {
+		return ";", "=", nil
+	}
+	if utf8.RuneCountInString(opt) != 2 {
+		return "", "", fmt.Errorf("kv option must be two characters (pair separator, key/value separator), got %q", opt)
+	}
+	pairSep, size := utf8.DecodeRuneInString(opt)
+	kvSep := opt[size:]
+	if string(pairSep) == kvSep {
+		return "", "", fmt.Errorf("kv option separators must differ, got %q", opt)
+	}
+	return string(pairSep), kvSep, nil
+}
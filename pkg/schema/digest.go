@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// DigestPrefix starts every digest returned by a Digester.
+const DigestPrefix = "hmac-sha256:"
+
+// Digester computes keyed digests of field values: "hmac-sha256:<hex>" of
+// the JSON encoding of a value (nil pointers encode as null, map keys in
+// sorted order), so equal values have equal digests under the same key.
+// Digests let a plan show that a sensitive value changed, and let apply
+// check it is unchanged, without storing the value. Without the key they
+// cannot be checked against guessed values.
+type Digester struct {
+	key []byte
+}
+
+// NewSalt returns a random, hex-encoded salt for NewDigester.
+func NewSalt() (string, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate digest salt: %w", err)
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// NewDigester returns a Digester keyed by salt, as returned by NewSalt, and
+// secret, which may be empty. A salt stored next to the digests only stops
+// precomputed guesses; a secret kept elsewhere stops all of them.
+func NewDigester(salt string, secret []byte) (Digester, error) {
+	key, err := hex.DecodeString(salt)
+	if err != nil {
+		return Digester{}, fmt.Errorf("invalid digest salt: %w", err)
+	}
+	return Digester{key: append(key, secret...)}, nil
+}
+
+// Digest returns the digest of v.
+func (d Digester) Digest(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", v))
+	}
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write(data)
+	return DigestPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// processDigester is keyed by random bytes drawn at start-up and never
+// stored.
+var processDigester = func() Digester {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("schema: generate digest key: %v", err))
+	}
+	return Digester{key: key}
+}()
+
+// Digest returns the digest of v under a key private to this process, as
+// reported by Field.Compare for sensitive fields. Such digests can only be
+// compared with others from the same process; digests stored in a plan
+// file are computed by a Digester whose salt the plan records.
+func Digest(v any) string {
+	return processDigester.Digest(v)
+}
+
+// compareDigest compares a sensitive field as a whole and reports digests.
+func compareDigest(eq equalFunc) comparer {
+	return func(oldField, newField reflect.Value, column string) []types.FieldChange {
+		if eq(oldField, newField) {
+			return nil
+		}
+		return []types.FieldChange{{
+			Field:    column,
+			OldValue: Digest(oldField.Interface()),
+			NewValue: Digest(newField.Interface()),
+		}}
+	}
+}
@@ -0,0 +1,44 @@
+// Package schema describes how planear maps a record type to CSV columns.
+//
+// A Schema is derived once per struct type from its `csv` struct tags and
+// cached for the life of the process. It is the single source of truth for
+// which columns planear manages: pkg/input uses it to decode CSV rows,
+// pkg/core/diff to compare records field by field, and pkg/formatters to
+// render records.
+//
+// # Tags
+//
+// Each exported field tagged `csv:"<column>[,option...]"` becomes a managed
+// column. A tag of "-" or an untagged field is not managed. Options are
+// comma-separated and may carry a value (`split=|`):
+//
+//   - split=S: separator for slice fields (default ",")
+//   - kv=PK:   pair and key/value separators for map fields (default ";=")
+//   - inline:  flatten a struct field, using the column name as a prefix
+//   - alias=A|B: other headers accepted for the column
+//   - optional: the column may be absent from the CSV file
+//   - default=V: value for an absent column or empty cell (implies optional)
+//   - fold:    compare strings ignoring case
+//   - trim:    compare strings ignoring surrounding whitespace
+//   - tolerance=X: numbers differing by at most X are equal
+//   - nilempty: a nil pointer equals a pointer to the zero value
+//   - sensitive: the value is a secret; diffs report its Digest and
+//     formatters and plan files never show it
+//
+// A field tagged `csv:"-" planear:"computed"` is a remote-only value, such
+// as a database ID or timestamp, loaded by LoadRemoteRecords. It is never
+// compared; plans copy it from the remote record into the updated one so
+// apply callbacks can use it.
+//
+// # Introspection
+//
+// Callers can list the managed columns of a type:
+//
+//	s, err := schema.Of[User]()
+//	if err != nil {
+//	    return err
+//	}
+//	for _, f := range s.Fields {
+//	    fmt.Println(f.Column, f.Type)
+//	}
+package schema
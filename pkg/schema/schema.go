@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/algebananazzzzz/planear/pkg/types"
+)
+
+// Field describes a single managed column and the struct field it maps to.
+type Field struct {
+	Column    string            // column header, including any inline prefix
+	Name      string            // Go field path, e.g. "Addr.City"
+	Index     []int             // index sequence for reflect.Value.FieldByIndex
+	Type      reflect.Type      // Go type of the field
+	Options   Options           // options from the `csv` tag
+	Tag       reflect.StructTag // full struct tag, for tags other than `csv`
+	Aliases   []string          // alternative headers accepted for Column
+	Optional  bool              // a missing column decodes as an empty cell
+	Default   *string           // used in place of a missing column or empty cell
+	TypeName  string            // short type description used in decode errors
+	Sensitive bool              // values are compared and reported as digests only
+
+	decode    func(reflect.Value, string) error
+	decodeErr error
+	equal     equalFunc
+	compare   comparer
+}
+
+// Decode sets field, the struct field value at f.Index, from a trimmed CSV
+// cell. It returns an error if the cell cannot be converted or the field's
+// type or tag options cannot be decoded from CSV at all.
+func (f *Field) Decode(field reflect.Value, raw string) error {
+	if f.decodeErr != nil {
+		return f.decodeErr
+	}
+	return f.decode(field, raw)
+}
+
+// Compare returns the changes between two values of the field. Slices and
+// maps report one change per differing element, named "<column>[<index>]"
+// or "<column>[<key>]". Sensitive fields are compared as a whole and report
+// the Digest of each value instead of the value itself.
+func (f *Field) Compare(oldField, newField reflect.Value) []types.FieldChange {
+	return f.compare(oldField, newField, f.Column)
+}
+
+// Equal reports whether two values of the field are equal, honouring the
+// comparison options of its tag (fold, trim, tolerance, nilempty).
+func (f *Field) Equal(oldField, newField reflect.Value) bool {
+	return f.equal(oldField, newField)
+}
+
+// Schema is the cached column mapping of a struct type.
+type Schema struct {
+	Type   reflect.Type
+	Fields []Field // managed columns in struct field order, inline structs flattened
+
+	// Computed lists the remote-only fields tagged `planear:"computed"`
+	// (for example database IDs or timestamps), which have no column and
+	// are never compared. Only Name, Index and Type are set.
+	Computed []Field
+
+	byColumn map[string]int
+	err      error
+}
+
+// Field returns the field managing column.
+func (s *Schema) Field(column string) (*Field, bool) {
+	i, ok := s.byColumn[column]
+	if !ok {
+		return nil, false
+	}
+	return &s.Fields[i], true
+}
+
+// Columns returns the managed column names in struct field order.
+func (s *Schema) Columns() []string {
+	columns := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		columns[i] = f.Column
+	}
+	return columns
+}
+
+// SensitiveColumns returns the columns tagged `sensitive`, in struct field
+// order.
+func (s *Schema) SensitiveColumns() []string {
+	var columns []string
+	for _, f := range s.Fields {
+		if f.Sensitive {
+			columns = append(columns, f.Column)
+		}
+	}
+	return columns
+}
+
+// Err reports the first tag or type problem of this type, such as an
+// unsupported field type or a tagged unexported field, which prevent
+// records from being decoded from CSV, or a comparison option that does not
+// fit its field, which is then compared with reflect.DeepEqual.
+func (s *Schema) Err() error {
+	return s.err
+}
+
+var cache sync.Map // reflect.Type -> *Schema
+
+// Of returns the schema of T, which must be a struct type.
+func Of[T any]() (*Schema, error) {
+	return For(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// For returns the schema of typ, which must be a struct type. Schemas are
+// built once per type and shared by every caller.
+func For(typ reflect.Type) (*Schema, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: %s is not a struct", typ)
+	}
+	if s, ok := cache.Load(typ); ok {
+		return s.(*Schema), nil
+	}
+	s := &Schema{Type: typ, byColumn: map[string]int{}}
+	s.collect(typ, nil, "", "")
+	actual, _ := cache.LoadOrStore(typ, s)
+	return actual.(*Schema), nil
+}
+
+// addComputed records a `planear:"computed"` field, which must not also be
+// mapped to a column.
+func (s *Schema) addComputed(sf reflect.StructField, parent []int, namePrefix, column string) {
+	goName := namePrefix + sf.Name
+	if column != "" && column != "-" {
+		s.fail(fmt.Errorf("computed field '%s' must not have a csv column", goName))
+		return
+	}
+	if !sf.IsExported() {
+		s.fail(fmt.Errorf("cannot set computed field '%s'", goName))
+		return
+	}
+	s.Computed = append(s.Computed, Field{
+		Name:  goName,
+		Index: append(append([]int{}, parent...), sf.Index[0]),
+		Type:  sf.Type,
+	})
+}
+
+// setComparer picks the equality and comparer for the field's type and
+// comparison options. Invalid options fall back to reflect.DeepEqual.
+func (f *Field) setComparer() error {
+	var err error
+	if f.equal, err = equalFor(f.Type, f.Options); err != nil {
+		f.equal = deepEqual
+	}
+	if f.Options.Has("sensitive") {
+		f.Sensitive = true
+		f.compare = compareDigest(f.equal)
+		return err
+	}
+	f.compare, _ = comparerFor(f.Type, f.Options)
+	return err
+}
+
+// fail records the first decode problem found while walking the type.
+func (s *Schema) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *Schema) collect(typ reflect.Type, parent []int, prefix, namePrefix string) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		name, opts := ParseTag(sf.Tag.Get("csv"))
+		if sf.Tag.Get("planear") == "computed" {
+			s.addComputed(sf, parent, namePrefix, name)
+			continue
+		}
+		if name == "-" || (name == "" && !opts.Has("inline")) {
+			continue
+		}
+
+		index := append(append([]int{}, parent...), i)
+		column := prefix + name
+		goName := namePrefix + sf.Name
+
+		if opts.Has("inline") {
+			if sf.Type.Kind() == reflect.Struct {
+				if !sf.IsExported() {
+					s.fail(fmt.Errorf("cannot set field '%s'", column))
+					continue
+				}
+				s.collect(sf.Type, index, column, goName+".")
+				continue
+			}
+			s.fail(fmt.Errorf("inline field '%s' must be a struct, got %s", sf.Name, sf.Type.Kind()))
+		}
+
+		if !sf.IsExported() {
+			s.fail(fmt.Errorf("cannot set field '%s'", column))
+			continue
+		}
+
+		f := Field{
+			Column:  column,
+			Name:    goName,
+			Index:   index,
+			Type:    sf.Type,
+			Options: opts,
+			Tag:     sf.Tag,
+		}
+		if err := f.setComparer(); err != nil {
+			s.fail(fmt.Errorf("field '%s': %v", column, err))
+		}
+		if err := f.setDecoder(); err != nil {
+			f.decodeErr = err
+			s.fail(err)
+		}
+		if alias, ok := opts["alias"]; ok {
+			for _, a := range strings.Split(alias, "|") {
+				f.Aliases = append(f.Aliases, prefix+a)
+			}
+		}
+		if def, ok := opts["default"]; ok {
+			f.Default = &def
+			if f.decodeErr == nil {
+				if err := f.decode(reflect.New(sf.Type).Elem(), def); err != nil {
+					f.decodeErr = fmt.Errorf("invalid default %q for field '%s': %v", def, column, err)
+					s.fail(f.decodeErr)
+				}
+			}
+		}
+		f.Optional = opts.Has("optional") || f.Default != nil
+
+		s.byColumn[column] = len(s.Fields)
+		s.Fields = append(s.Fields, f)
+	}
+}
@@ -0,0 +1,322 @@
+package schema_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+	"github.com/algebananazzzzz/planear/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type Address struct {
+	City string `csv:"city"`
+	Zip  string `csv:"zip,optional"`
+}
+
+type User struct {
+	ID       string            `csv:"id"`
+	Email    string            `csv:"email,alias=Email|e-mail"`
+	Score    *int              `csv:"score,default=10"`
+	Roles    []string          `csv:"roles,split=|"`
+	Labels   map[string]string `csv:"labels"`
+	Addr     Address           `csv:"addr_,inline"`
+	Computed string            `csv:"-"`
+	Untagged string
+}
+
+func TestOf_DescribesManagedColumns(t *testing.T) {
+	s, err := schema.Of[User]()
+	require.NoError(t, err)
+	require.NoError(t, s.Err())
+	require.Equal(t, reflect.TypeOf(User{}), s.Type)
+	require.Equal(t, []string{"id", "email", "score", "roles", "labels", "addr_city", "addr_zip"}, s.Columns())
+
+	email, ok := s.Field("email")
+	require.True(t, ok)
+	require.Equal(t, []string{"Email", "e-mail"}, email.Aliases)
+	require.False(t, email.Optional)
+
+	score, ok := s.Field("score")
+	require.True(t, ok)
+	require.Equal(t, "10", *score.Default)
+	require.True(t, score.Optional)
+	require.Equal(t, "int", score.TypeName)
+
+	roles, ok := s.Field("roles")
+	require.True(t, ok)
+	require.Equal(t, "|", roles.Options["split"])
+	require.Equal(t, "list", roles.TypeName)
+
+	zip, ok := s.Field("addr_zip")
+	require.True(t, ok)
+	require.Equal(t, "Addr.Zip", zip.Name)
+	require.Equal(t, []int{5, 1}, zip.Index)
+	require.True(t, zip.Optional)
+
+	_, ok = s.Field("Untagged")
+	require.False(t, ok)
+}
+
+func TestOf_IsCached(t *testing.T) {
+	first, err := schema.Of[User]()
+	require.NoError(t, err)
+	second, err := schema.For(reflect.TypeOf(User{}))
+	require.NoError(t, err)
+	require.Same(t, first, second)
+}
+
+func TestFor_NonStruct_Error(t *testing.T) {
+	_, err := schema.Of[*User]()
+	require.ErrorContains(t, err, "is not a struct")
+
+	_, err = schema.Of[int]()
+	require.ErrorContains(t, err, "is not a struct")
+}
+
+func TestSchema_ErrReportsUndecodableFields(t *testing.T) {
+	type Mixed struct {
+		ID      string     `csv:"id"`
+		Ratio   complex128 `csv:"ratio"`
+		private string     `csv:"private"`
+	}
+
+	s, err := schema.Of[Mixed]()
+	require.NoError(t, err)
+	require.ErrorContains(t, s.Err(), "unsupported field type 'complex128' for field 'ratio'")
+
+	// The field stays managed for comparison; only decoding fails.
+	require.Equal(t, []string{"id", "ratio"}, s.Columns())
+	ratio, _ := s.Field("ratio")
+	var m Mixed
+	require.Error(t, ratio.Decode(reflect.ValueOf(&m).Elem().Field(1), "0.5"))
+	require.Equal(t, []types.FieldChange{{Field: "ratio", OldValue: complex(0.5, 0), NewValue: complex(1.5, 0)}},
+		ratio.Compare(reflect.ValueOf(complex(0.5, 0)), reflect.ValueOf(complex(1.5, 0))))
+}
+
+func TestField_Decode(t *testing.T) {
+	s, err := schema.Of[User]()
+	require.NoError(t, err)
+
+	var u User
+	v := reflect.ValueOf(&u).Elem()
+	for column, raw := range map[string]string{
+		"id":        "u1",
+		"score":     "7",
+		"roles":     "admin|dev",
+		"labels":    "env=prod;tier=web",
+		"addr_city": "Paris",
+	} {
+		f, ok := s.Field(column)
+		require.True(t, ok)
+		require.NoError(t, f.Decode(v.FieldByIndex(f.Index), raw))
+	}
+
+	score := 7
+	require.Equal(t, User{
+		ID:     "u1",
+		Score:  &score,
+		Roles:  []string{"admin", "dev"},
+		Labels: map[string]string{"env": "prod", "tier": "web"},
+		Addr:   Address{City: "Paris"},
+	}, u)
+}
+
+func TestParseTag(t *testing.T) {
+	name, opts := schema.ParseTag("roles,split=|,optional")
+	require.Equal(t, "roles", name)
+	require.Equal(t, schema.Options{"split": "|", "optional": ""}, opts)
+	require.True(t, opts.Has("optional"))
+	require.False(t, opts.Has("inline"))
+}
+
+func TestReplaceText(t *testing.T) {
+	type Secretive struct {
+		Token  string  `csv:"token"`
+		Backup *string `csv:"backup"`
+		Unset  *string `csv:"unset"`
+		Count  int     `csv:"count"`
+	}
+
+	backup := "b"
+	rec := Secretive{Token: "t", Backup: &backup}
+	out, err := schema.ReplaceText(rec, []string{"token", "backup", "unset"}, func(column, value string) (string, error) {
+		return column + "=" + value, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "token=t", out.Token)
+	require.Equal(t, "backup=b", *out.Backup)
+	require.Nil(t, out.Unset)
+	require.Equal(t, "b", backup, "the original pointee is left untouched")
+
+	_, err = schema.ReplaceText(rec, []string{"count"}, func(_, v string) (string, error) { return v, nil })
+	require.ErrorContains(t, err, `column "count" of schema_test.Secretive is not a string field`)
+}
+
+func TestField_SensitiveComparesDigests(t *testing.T) {
+	type Login struct {
+		User     string   `csv:"user"`
+		Password string   `csv:"password,sensitive"`
+		Keys     []string `csv:"keys,sensitive"`
+	}
+
+	s, err := schema.Of[Login]()
+	require.NoError(t, err)
+	require.Equal(t, []string{"password", "keys"}, s.SensitiveColumns())
+
+	password, _ := s.Field("password")
+	require.True(t, password.Sensitive)
+	require.Equal(t, []types.FieldChange{{
+		Field:    "password",
+		OldValue: schema.Digest("old"),
+		NewValue: schema.Digest("new"),
+	}}, password.Compare(reflect.ValueOf("old"), reflect.ValueOf("new")))
+	require.Empty(t, password.Compare(reflect.ValueOf("same"), reflect.ValueOf("same")))
+
+	// Sensitive collections are compared as a whole, not element by element.
+	keys, _ := s.Field("keys")
+	changes := keys.Compare(reflect.ValueOf([]string{"a", "b"}), reflect.ValueOf([]string{"a", "c"}))
+	require.Len(t, changes, 1)
+	require.Equal(t, "keys", changes[0].Field)
+	require.Empty(t, keys.Compare(reflect.ValueOf([]string(nil)), reflect.ValueOf([]string{})))
+}
+
+func TestDigest(t *testing.T) {
+	require.Equal(t, schema.Digest("s3cr3t"), schema.Digest("s3cr3t"))
+	require.NotEqual(t, schema.Digest("s3cr3t"), schema.Digest("s3cr3T"))
+	require.Regexp(t, `^hmac-sha256:[0-9a-f]{64}$`, schema.Digest(42))
+	require.NotContains(t, schema.Digest("s3cr3t"), "s3cr3t")
+
+	var nilPtr *string
+	require.Equal(t, schema.Digest(nil), schema.Digest(nilPtr))
+}
+
+func TestDigester(t *testing.T) {
+	salt, err := schema.NewSalt()
+	require.NoError(t, err)
+	other, err := schema.NewSalt()
+	require.NoError(t, err)
+	require.NotEqual(t, salt, other)
+
+	d, err := schema.NewDigester(salt, nil)
+	require.NoError(t, err)
+	same, err := schema.NewDigester(salt, nil)
+	require.NoError(t, err)
+	require.Equal(t, d.Digest("s3cr3t"), same.Digest("s3cr3t"))
+	require.Regexp(t, `^hmac-sha256:[0-9a-f]{64}$`, d.Digest("s3cr3t"))
+
+	// A different salt or secret gives different digests of the same value.
+	salted, err := schema.NewDigester(other, nil)
+	require.NoError(t, err)
+	keyed, err := schema.NewDigester(salt, []byte("ci-secret"))
+	require.NoError(t, err)
+	require.NotEqual(t, d.Digest("s3cr3t"), salted.Digest("s3cr3t"))
+	require.NotEqual(t, d.Digest("s3cr3t"), keyed.Digest("s3cr3t"))
+	require.NotEqual(t, d.Digest("s3cr3t"), schema.Digest("s3cr3t"))
+
+	_, err = schema.NewDigester("not hex", nil)
+	require.ErrorContains(t, err, "invalid digest salt")
+}
+
+func TestField_ComparisonOptions(t *testing.T) {
+	type Item struct {
+		Name  string            `csv:"name,fold,trim"`
+		Price *float64          `csv:"price,tolerance=0.01,nilempty"`
+		Qty   int               `csv:"qty,tolerance=2"`
+		Tags  []string          `csv:"tags,fold"`
+		Attrs map[string]string `csv:"attrs,trim"`
+	}
+
+	s, err := schema.Of[Item]()
+	require.NoError(t, err)
+	require.NoError(t, s.Err())
+
+	field := func(column string) *schema.Field {
+		f, ok := s.Field(column)
+		require.True(t, ok)
+		return f
+	}
+	equal := func(column string, a, b any) bool {
+		return field(column).Equal(reflect.ValueOf(a), reflect.ValueOf(b))
+	}
+	zero, price, near, far := 0.0, 1.00, 1.005, 1.02
+
+	require.True(t, equal("name", " Widget", "widget "))
+	require.False(t, equal("name", "widget", "gadget"))
+	require.True(t, equal("price", &price, &near))
+	require.False(t, equal("price", &price, &far))
+	require.True(t, equal("price", (*float64)(nil), &zero))
+	require.False(t, equal("price", (*float64)(nil), &price))
+	require.True(t, equal("qty", 10, 12))
+	require.False(t, equal("qty", 10, 13))
+	require.True(t, equal("tags", []string{"A", "b"}, []string{"a", "B"}))
+	require.True(t, equal("attrs", map[string]string{"k": " v"}, map[string]string{"k": "v"}))
+
+	require.Equal(t, []types.FieldChange{{Field: "tags[1]", OldValue: "b", NewValue: "c"}},
+		field("tags").Compare(reflect.ValueOf([]string{"A", "b"}), reflect.ValueOf([]string{"a", "c"})))
+}
+
+func TestSchema_ErrReportsInvalidComparisonOptions(t *testing.T) {
+	type FoldedInt struct {
+		Count int `csv:"count,fold"`
+	}
+	s, err := schema.Of[FoldedInt]()
+	require.NoError(t, err)
+	require.EqualError(t, s.Err(), "field 'count': option fold applies to strings, not int")
+
+	type BadTolerance struct {
+		Price float64 `csv:"price,tolerance=abc"`
+	}
+	s, err = schema.Of[BadTolerance]()
+	require.NoError(t, err)
+	require.EqualError(t, s.Err(), `field 'price': invalid tolerance "abc"`)
+}
+
+func TestField_DecodeFloat(t *testing.T) {
+	type Priced struct {
+		Price  float64  `csv:"price"`
+		Weight *float32 `csv:"weight"`
+	}
+	s, err := schema.Of[Priced]()
+	require.NoError(t, err)
+
+	var p Priced
+	v := reflect.ValueOf(&p).Elem()
+	price, _ := s.Field("price")
+	require.NoError(t, price.Decode(v.Field(0), "19.99"))
+	require.Equal(t, 19.99, p.Price)
+	require.Equal(t, "float", price.TypeName)
+	require.Error(t, price.Decode(v.Field(0), "cheap"))
+
+	weight, _ := s.Field("weight")
+	require.NoError(t, weight.Decode(v.Field(1), "0.5"))
+	require.Equal(t, float32(0.5), *p.Weight)
+}
+
+func TestOf_ComputedFields(t *testing.T) {
+	type Meta struct {
+		Etag string `planear:"computed"`
+	}
+	type Stored struct {
+		ID    string `csv:"id"`
+		RowID int64  `csv:"-" planear:"computed"`
+		Meta  Meta   `csv:"meta_,inline"`
+	}
+
+	s, err := schema.Of[Stored]()
+	require.NoError(t, err)
+	require.NoError(t, s.Err())
+	require.Equal(t, []string{"id"}, s.Columns())
+	require.Len(t, s.Computed, 2)
+	require.Equal(t, "RowID", s.Computed[0].Name)
+	require.Equal(t, []int{1}, s.Computed[0].Index)
+	require.Equal(t, "Meta.Etag", s.Computed[1].Name)
+	require.Equal(t, []int{2, 0}, s.Computed[1].Index)
+
+	type Mapped struct {
+		ID string `csv:"id" planear:"computed"`
+	}
+	s, err = schema.Of[Mapped]()
+	require.NoError(t, err)
+	require.EqualError(t, s.Err(), "computed field 'ID' must not have a csv column")
+}
@@ -0,0 +1,26 @@
+package schema
+
+import "strings"
+
+// Options holds the comma-separated options following the column name in a
+// `csv` struct tag, e.g. `csv:"roles,split=|"` yields {"split": "|"}.
+// Options without a value map to the empty string.
+type Options map[string]string
+
+// ParseTag splits a `csv` tag into its column name and options. Option
+// values cannot themselves contain a comma.
+func ParseTag(tag string) (string, Options) {
+	parts := strings.Split(tag, ",")
+	opts := Options{}
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		opts[strings.TrimSpace(key)] = value
+	}
+	return parts[0], opts
+}
+
+// Has reports whether the option is present, with or without a value.
+func (o Options) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// IsText reports whether the field holds its CSV cell verbatim, i.e. it is a
+// string or a pointer to a string.
+func (f *Field) IsText() bool {
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.String
+}
+
+// ReplaceText returns a copy of rec in which each listed text column (see
+// Field.IsText) is set to replace(column, current value). Nil *string
+// fields are left nil. Columns that are unknown or not text are an error.
+func ReplaceText[T any](rec T, columns []string, replace func(column, value string) (string, error)) (T, error) {
+	if len(columns) == 0 {
+		return rec, nil
+	}
+	v := reflect.ValueOf(&rec).Elem()
+	s, err := For(v.Type())
+	if err != nil {
+		return rec, err
+	}
+
+	for _, column := range columns {
+		f, ok := s.Field(column)
+		if !ok || !f.IsText() {
+			return rec, fmt.Errorf("column %q of %s is not a string field", column, s.Type)
+		}
+		field := v.FieldByIndex(f.Index)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			// Copy the pointee so the caller's record is left untouched.
+			ptr := reflect.New(field.Type().Elem())
+			ptr.Elem().Set(field.Elem())
+			field.Set(ptr)
+			field = ptr.Elem()
+		}
+		value, err := replace(column, field.String())
+		if err != nil {
+			return rec, err
+		}
+		field.SetString(value)
+	}
+	return rec, nil
+}
@@ -0,0 +1,15 @@
+package types
+
+// ConflictPolicy decides which side wins a three-way diff conflict: a field
+// that both the CSV and the remote system changed, to different values,
+// since the last apply. Zero value = ConflictKeepRemote.
+type ConflictPolicy int
+
+const (
+	// ConflictKeepRemote leaves conflicting fields at their remote value and
+	// only reports them in Plan.Conflicts. Default.
+	ConflictKeepRemote ConflictPolicy = iota
+	// ConflictLocalWins plans the CSV value for conflicting fields, like a
+	// two-way diff would, and still reports them in Plan.Conflicts.
+	ConflictLocalWins
+)
@@ -0,0 +1,20 @@
+package types
+
+// DecodeErrorPolicy controls how plan generation reacts to CSV rows or cells
+// that cannot be decoded. Zero value = DecodeErrorFailFast (preserves the
+// original abort-on-first-error behavior).
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorFailFast aborts plan generation at the first bad cell.
+	// Default; preserves backward compatibility.
+	DecodeErrorFailFast DecodeErrorPolicy = iota
+	// DecodeErrorFailAll decodes every CSV file, then aborts with a single
+	// error listing every bad file, row and cell, so all typos can be fixed
+	// in one pass.
+	DecodeErrorFailAll
+	// DecodeErrorIgnoreRow moves rows with bad cells into Plan.Ignores, with
+	// the decode error as the reason, and keeps generating the plan. Errors
+	// affecting a whole file (missing columns, malformed CSV) still abort.
+	DecodeErrorIgnoreRow
+)
@@ -0,0 +1,15 @@
+package types
+
+// DeletionPolicy controls whether remote records missing from the local CSVs
+// become deletions. Zero value = DeletionAllow (preserves the original
+// behavior of deleting every such record).
+type DeletionPolicy int
+
+const (
+	// DeletionAllow plans a deletion for every remote record without a
+	// local counterpart. Default; preserves backward compatibility.
+	DeletionAllow DeletionPolicy = iota
+	// DeletionNever plans no deletions at all (additive-only mode): remote
+	// records missing locally are left alone.
+	DeletionNever
+)
@@ -0,0 +1,19 @@
+package types
+
+// IgnorePolicy controls whether records ending up in Plan.Ignores (failed
+// decoding with DecodeErrorIgnoreRow, ValidateRecord or ValidateSet) fail
+// plan generation. Zero value = IgnoreAllow (preserves the original
+// behavior of only reporting them).
+type IgnorePolicy int
+
+const (
+	// IgnoreAllow keeps ignored records in the plan and writes it. Default;
+	// preserves backward compatibility.
+	IgnoreAllow IgnorePolicy = iota
+	// IgnoreFailIfAny rejects the plan when any record is ignored, so CI can
+	// block changes that contain broken rows.
+	IgnoreFailIfAny
+	// IgnoreFailAboveThreshold rejects the plan when more records are
+	// ignored than GenerateParams.IgnoreThreshold.
+	IgnoreFailAboveThreshold
+)
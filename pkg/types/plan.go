@@ -1,5 +1,7 @@
 package types
 
+import "sort"
+
 type Plan[T any] struct {
 	Additions []RecordAddition[T] `json:"additions"`
 	Updates   []RecordUpdate[T]   `json:"updates"`
@@ -11,6 +13,39 @@ type Plan[T any] struct {
 	// Updates / Deletions by (Kind, Key). Populated by Generate when
 	// GenerateParams.DependsOn is set.
 	Layers [][]LayerOp `json:"layers,omitempty"`
+	// Sensitive lists, per key, the columns whose values must not be shown
+	// or stored in plain text, such as cells filled by `${secret:...}`
+	// interpolation. Formatters print them as "(sensitive)".
+	Sensitive map[string][]string `json:"sensitive,omitempty"`
+	// SensitiveColumns lists the columns that are sensitive for every
+	// record, from `csv:",sensitive"` tags and GenerateParams.SensitiveFields.
+	// The plan file stores their values redacted and their field changes as
+	// digests.
+	SensitiveColumns []string `json:"sensitive_columns,omitempty"`
+	// Digests holds, per key of an addition or update, the digest of each
+	// sensitive column's planned value. apply.Run reloads the real values
+	// from the CSV and refuses to apply them if a digest no longer matches.
+	Digests map[string]map[string]string `json:"digests,omitempty"`
+	// DigestSalt is the random, hex-encoded salt that keys the digests of
+	// this plan when GenerateParams.DigestKey is not set (see
+	// schema.NewDigester).
+	DigestSalt string `json:"digest_salt,omitempty"`
+	// Unset lists, per key of an update, the SensitiveColumns the CSV left
+	// unset (see GenerateParams.IgnoreUnset). Their planned values are the
+	// remote ones, so their digests are too, and apply.Run reloads them from
+	// the remote records rather than the CSV.
+	Unset map[string][]string `json:"unset,omitempty"`
+	// Conflicts lists records whose fields were changed both in the CSV and
+	// remotely since the last apply, as found by a three-way diff (see
+	// GenerateParams.LastAppliedPath). How they are planned depends on
+	// GenerateParams.OnConflict.
+	Conflicts []RecordConflict `json:"conflicts,omitempty"`
+	// InSync holds, by key, the local records that already match their
+	// remote ones, as the CSV has them, when GenerateParams.LastAppliedPath
+	// is set. apply.Run adds them to the last-applied snapshot once every
+	// operation succeeded, so that later remote changes to them are
+	// detected. Interpolated cells hold their `${...}` templates.
+	InSync map[string]T `json:"in_sync,omitempty"`
 }
 
 // LayerOp identifies a single operation within a layered execution plan.
@@ -42,3 +77,18 @@ func (plan *Plan[T]) IsEmpty() bool {
 		len(plan.Deletions) == 0 &&
 		len(plan.Ignores) == 0
 }
+
+// Sort orders every section of the plan, Conflicts included, by key using
+// less, or by plain string order when less is nil. Entries with equal keys
+// keep their relative order. Sorted plans make plan files reproducible and
+// the non-layered apply order deterministic.
+func (plan *Plan[T]) Sort(less func(a, b string) bool) {
+	if less == nil {
+		less = func(a, b string) bool { return a < b }
+	}
+	sort.SliceStable(plan.Additions, func(i, j int) bool { return less(plan.Additions[i].Key, plan.Additions[j].Key) })
+	sort.SliceStable(plan.Updates, func(i, j int) bool { return less(plan.Updates[i].Key, plan.Updates[j].Key) })
+	sort.SliceStable(plan.Deletions, func(i, j int) bool { return less(plan.Deletions[i].Key, plan.Deletions[j].Key) })
+	sort.SliceStable(plan.Ignores, func(i, j int) bool { return less(plan.Ignores[i].Key, plan.Ignores[j].Key) })
+	sort.SliceStable(plan.Conflicts, func(i, j int) bool { return less(plan.Conflicts[i].Key, plan.Conflicts[j].Key) })
+}
@@ -52,3 +52,18 @@ func TestLayerOpConstants(t *testing.T) {
 	require.Equal(t, types.LayerOpKind("update"), types.LayerOpUpdate)
 	require.Equal(t, types.LayerOpKind("delete"), types.LayerOpDelete)
 }
+
+func TestPlan_Sort(t *testing.T) {
+	p := types.Plan[rec]{
+		Additions: []types.RecordAddition[rec]{{Key: "b"}, {Key: "a"}, {Key: "c"}},
+		Ignores:   []types.RecordIgnored[rec]{{Key: "x", Reason: "first"}, {Key: "w"}, {Key: "x", Reason: "second"}},
+		Conflicts: []types.RecordConflict{{Key: "2"}, {Key: "1"}},
+	}
+	p.Sort(nil)
+	require.Equal(t, []types.RecordAddition[rec]{{Key: "a"}, {Key: "b"}, {Key: "c"}}, p.Additions)
+	require.Equal(t, []types.RecordIgnored[rec]{{Key: "w"}, {Key: "x", Reason: "first"}, {Key: "x", Reason: "second"}}, p.Ignores)
+	require.Equal(t, "1", p.Conflicts[0].Key)
+
+	p.Sort(func(a, b string) bool { return a > b })
+	require.Equal(t, []types.RecordAddition[rec]{{Key: "c"}, {Key: "b"}, {Key: "a"}}, p.Additions)
+}
@@ -10,6 +10,9 @@ type FieldChange struct {
 type RecordAddition[T any] struct {
 	Key string `json:"key"`
 	New T      `json:"new"`
+	// LocalKey is the key as extracted from the CSV record when
+	// GenerateParams.KeyNormalizer changed it; empty when equal to Key.
+	LocalKey string `json:"local_key,omitempty"`
 }
 
 // RecordUpdate represents a record that will be updated.
@@ -18,12 +21,25 @@ type RecordUpdate[T any] struct {
 	Changes []FieldChange `json:"changes"`
 	Old     T             `json:"old"`
 	New     T             `json:"new"`
+	// LocalKey and RemoteKey are the keys of the local and remote record
+	// when GenerateParams.KeyNormalizer changed them; empty when equal to
+	// Key.
+	LocalKey  string `json:"local_key,omitempty"`
+	RemoteKey string `json:"remote_key,omitempty"`
+	// Local is the CSV record when a three-way diff took some fields of New
+	// from the remote record; nil when New is the CSV record. apply.Run
+	// stores it in the last-applied snapshot, so fields changed out of band
+	// are not mistaken for CSV changes by the next plan.
+	Local *T `json:"local,omitempty"`
 }
 
 // RecordDeletion represents a record that will be removed.
 type RecordDeletion[T any] struct {
 	Key string `json:"key"`
 	Old T      `json:"old"`
+	// RemoteKey is the key of the remote record when
+	// GenerateParams.KeyNormalizer changed it; empty when equal to Key.
+	RemoteKey string `json:"remote_key,omitempty"`
 }
 
 // RecordIgnored represents a record that was skipped for some reason.
@@ -31,4 +47,28 @@ type RecordIgnored[T any] struct {
 	Key    string `json:"key"`
 	Record T      `json:"record"`
 	Reason string `json:"reason"`
+	// LocalKey is the key as extracted from the CSV record when
+	// GenerateParams.KeyNormalizer changed it; empty when equal to Key.
+	LocalKey string `json:"local_key,omitempty"`
+}
+
+// RecordConflict lists the fields of a record that both the CSV and the
+// remote system changed since the last apply, to different values.
+type RecordConflict struct {
+	Key    string          `json:"key"`
+	Fields []FieldConflict `json:"fields"`
+	// Policy is the ConflictPolicy the plan applied to Fields. With
+	// ConflictKeepRemote, apply.Run keeps their last-applied values in the
+	// snapshot so the conflict is reported again until it is resolved.
+	Policy ConflictPolicy `json:"policy"`
+}
+
+// FieldConflict holds the last-applied (Base), CSV (Local) and current
+// remote (Remote) values of a conflicting field. Sensitive fields hold
+// "(sensitive)" (formatters.Redacted) instead of their values.
+type FieldConflict struct {
+	Field  string `json:"field"`
+	Base   any    `json:"base"`
+	Local  any    `json:"local"`
+	Remote any    `json:"remote"`
 }
@@ -0,0 +1,15 @@
+package types
+
+// SetValidationPolicy controls what plan generation does with the records
+// rejected by GenerateParams.ValidateSet. Zero value = SetValidationIgnore,
+// matching how records failing ValidateRecord are handled.
+type SetValidationPolicy int
+
+const (
+	// SetValidationIgnore moves each rejected record into Plan.Ignores, with
+	// the returned error as the reason, and keeps generating the plan.
+	SetValidationIgnore SetValidationPolicy = iota
+	// SetValidationFail aborts plan generation, before the plan file is
+	// written, with an error listing every rejected key.
+	SetValidationFail
+)
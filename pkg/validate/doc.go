@@ -0,0 +1,38 @@
+// Package validate checks records against rules declared in `validate`
+// struct tags, so common checks need not be written by hand in every
+// GenerateParams.ValidateRecord.
+//
+// # Rules
+//
+// Rules are comma-separated and apply to the managed columns of a record
+// (see package schema), in the order they are written:
+//
+//   - required:  the value is not the zero value (nil, "", 0, empty slice)
+//   - omitempty: skip the remaining rules when the value, or the value it
+//     points to, is the zero value
+//   - min=N, max=N: bounds for numbers, or for the length of strings
+//     (in characters), slices and maps
+//   - len=N:     exact length of a string, slice or map
+//   - oneof=A|B|C: the value, formatted with fmt.Sprint, is one of A, B, C
+//   - email:     a bare email address such as ada@example.com
+//   - url:       an absolute URL with a scheme and host
+//   - regex=RE:  the string matches RE; as RE may contain commas it must be
+//     the last rule of the tag
+//
+// A nil pointer only fails required; every other rule applies to the value
+// it points to. On string slices, oneof, email, url and regex apply to each
+// element.
+//
+// # Usage
+//
+//	type User struct {
+//	    Email string `csv:"email" validate:"required,email"`
+//	    Tier  string `csv:"tier" validate:"oneof=free|pro"`
+//	    Photo *string `csv:"photo" validate:"omitempty,url"`
+//	}
+//
+//	params.ValidateRecord = validate.All(validate.Struct[User], checkQuota)
+//
+// Struct reports every failing rule of a record at once as Errors, so the
+// reason stored in Plan.Ignores lists every problem.
+package validate
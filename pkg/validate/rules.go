@@ -0,0 +1,244 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// rule is a compiled rule; check returns a failure message or "".
+type rule struct {
+	name  string
+	check func(reflect.Value) string
+}
+
+// compileRules parses a `validate` tag for field f.
+func compileRules(f *schema.Field, tag string) ([]rule, error) {
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var rules []rule
+	for tag != "" {
+		part := tag
+		if strings.HasPrefix(part, "regex=") {
+			tag = ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		var check func(reflect.Value) string
+		var err error
+		switch name {
+		case "required":
+			check = checkRequired
+		case "omitempty":
+			check = nil
+		case "min", "max":
+			check, err = boundRule(t, name, arg)
+		case "len":
+			check, err = lenRule(t, arg)
+		case "oneof":
+			check, err = oneofRule(t, arg)
+		case "email":
+			check, err = stringRule(t, name, func(s string) string {
+				addr, err := mail.ParseAddress(s)
+				if err != nil || addr.Address != s {
+					return "must be a valid email address"
+				}
+				return ""
+			})
+		case "url":
+			check, err = stringRule(t, name, func(s string) string {
+				u, err := url.ParseRequestURI(s)
+				if err != nil || u.Scheme == "" || u.Host == "" {
+					return "must be a valid URL"
+				}
+				return ""
+			})
+		case "regex":
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(arg); err != nil {
+				return nil, fmt.Errorf("rule regex: %w", err)
+			}
+			check, err = stringRule(t, name, func(s string) string {
+				if !re.MatchString(s) {
+					return fmt.Sprintf("must match %s", re)
+				}
+				return ""
+			})
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name != "required" && check != nil {
+			check = skipNil(check)
+		}
+		rules = append(rules, rule{name: name, check: check})
+	}
+	return rules, nil
+}
+
+// skipNil makes check pass nil pointers and see the pointee otherwise.
+func skipNil(check func(reflect.Value) string) func(reflect.Value) string {
+	return func(v reflect.Value) string {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		return check(v)
+	}
+}
+
+func checkRequired(v reflect.Value) string {
+	if v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0) {
+		return "is required"
+	}
+	return ""
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasLength(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func numberOf(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func lengthOf(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+func boundRule(t reflect.Type, name, arg string) (func(reflect.Value) string, error) {
+	word, within := "least", func(n, bound float64) bool { return n >= bound }
+	if name == "max" {
+		word, within = "most", func(n, bound float64) bool { return n <= bound }
+	}
+	switch {
+	case isNumber(t):
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid number %q", name, arg)
+		}
+		return func(v reflect.Value) string {
+			if !within(numberOf(v), bound) {
+				return fmt.Sprintf("must be at %s %s", word, arg)
+			}
+			return ""
+		}, nil
+	case hasLength(t):
+		bound, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid length %q", name, arg)
+		}
+		return func(v reflect.Value) string {
+			if !within(float64(lengthOf(v)), float64(bound)) {
+				return fmt.Sprintf("length must be at %s %d", word, bound)
+			}
+			return ""
+		}, nil
+	}
+	return nil, fmt.Errorf("rule %s does not apply to %s", name, t)
+}
+
+func lenRule(t reflect.Type, arg string) (func(reflect.Value) string, error) {
+	if !hasLength(t) {
+		return nil, fmt.Errorf("rule len does not apply to %s", t)
+	}
+	want, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("rule len: invalid length %q", arg)
+	}
+	return func(v reflect.Value) string {
+		if lengthOf(v) != want {
+			return fmt.Sprintf("length must be %d", want)
+		}
+		return ""
+	}, nil
+}
+
+func oneofRule(t reflect.Type, arg string) (func(reflect.Value) string, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("rule oneof: no values")
+	}
+	allowed := strings.Split(arg, "|")
+	check := func(v reflect.Value) string {
+		s := fmt.Sprint(v.Interface())
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))
+	}
+	if t.Kind() == reflect.Slice {
+		return eachElement(check), nil
+	}
+	if t.Kind() == reflect.Map || t.Kind() == reflect.Struct {
+		return nil, fmt.Errorf("rule oneof does not apply to %s", t)
+	}
+	return check, nil
+}
+
+// stringRule applies a check to a string, or to each element of a string
+// slice.
+func stringRule(t reflect.Type, name string, check func(string) string) (func(reflect.Value) string, error) {
+	str := func(v reflect.Value) string { return check(v.String()) }
+	switch {
+	case t.Kind() == reflect.String:
+		return str, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		return eachElement(str), nil
+	}
+	return nil, fmt.Errorf("rule %s does not apply to %s", name, t)
+}
+
+// eachElement applies check to every element of a slice, reporting the
+// index of the first failure.
+func eachElement(check func(reflect.Value) string) func(reflect.Value) string {
+	return func(v reflect.Value) string {
+		for i := 0; i < v.Len(); i++ {
+			if msg := check(v.Index(i)); msg != "" {
+				return fmt.Sprintf("element %d %s", i, msg)
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,151 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/algebananazzzzz/planear/pkg/schema"
+)
+
+// FieldError is a single failed rule.
+type FieldError struct {
+	Column  string // column of the failing field; empty for errors from custom validators
+	Rule    string // rule name, e.g. "min"; empty for errors from custom validators
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Column == "" {
+		return e.Message
+	}
+	return e.Column + ": " + e.Message
+}
+
+// Errors lists every rule a record failed.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator checks records of type T against their `validate` tags.
+type Validator[T any] struct {
+	fields []fieldRules
+}
+
+type fieldRules struct {
+	field *schema.Field
+	rules []rule
+}
+
+var cache sync.Map // reflect.Type -> *Validator[T]
+
+// For returns the Validator of T, compiling its `validate` tags on first
+// use. It returns an error if T is not a struct or a tag names an unknown
+// rule, has a malformed argument or uses a rule that does not apply to the
+// field's type.
+func For[T any]() (*Validator[T], error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if cached, ok := cache.Load(typ); ok {
+		return cached.(*Validator[T]), nil
+	}
+
+	s, err := schema.For(typ)
+	if err != nil {
+		return nil, err
+	}
+	v := &Validator[T]{}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok || tag == "" {
+			continue
+		}
+		rules, err := compileRules(f, tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validate tag on field '%s': %w", f.Column, err)
+		}
+		v.fields = append(v.fields, fieldRules{field: f, rules: rules})
+	}
+
+	actual, _ := cache.LoadOrStore(typ, v)
+	return actual.(*Validator[T]), nil
+}
+
+// Validate returns Errors listing every failing rule of rec, in field and
+// rule order, or nil if rec passes.
+func (v *Validator[T]) Validate(rec T) error {
+	rv := reflect.ValueOf(rec)
+	var errs Errors
+	for _, fr := range v.fields {
+		value := rv.FieldByIndex(fr.field.Index)
+		for _, r := range fr.rules {
+			if r.name == "omitempty" {
+				if isEmpty(value) {
+					break
+				}
+				continue
+			}
+			if msg := r.check(value); msg != "" {
+				errs = append(errs, FieldError{Column: fr.field.Column, Rule: r.name, Message: msg})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isEmpty reports whether v, or the value it points to, is the zero value
+// or an empty slice or map.
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return checkRequired(v) != ""
+}
+
+// Struct validates rec against the `validate` tags of T. It can be used as
+// GenerateParams.ValidateRecord directly or combined with All. An invalid
+// tag is reported as the error of every record.
+func Struct[T any](rec T) error {
+	v, err := For[T]()
+	if err != nil {
+		return err
+	}
+	return v.Validate(rec)
+}
+
+// All returns a validator running every validator in order and reporting
+// all of their failures together as Errors. Errors returned by Struct are
+// merged rule by rule; any other error becomes a FieldError with only a
+// Message.
+func All[T any](validators ...func(T) error) func(T) error {
+	return func(rec T) error {
+		var errs Errors
+		for _, validate := range validators {
+			err := validate(rec)
+			if err == nil {
+				continue
+			}
+			var fieldErrs Errors
+			if errors.As(err, &fieldErrs) {
+				errs = append(errs, fieldErrs...)
+			} else {
+				errs = append(errs, FieldError{Message: err.Error()})
+			}
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		return errs
+	}
+}
@@ -0,0 +1,111 @@
+package validate_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/algebananazzzzz/planear/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+type Contact struct {
+	ID    string   `csv:"id" validate:"required,len=4"`
+	Email string   `csv:"email" validate:"required,email"`
+	Site  *string  `csv:"site" validate:"omitempty,url"`
+	Age   *int     `csv:"age" validate:"min=18,max=130"`
+	Tier  string   `csv:"tier" validate:"oneof=free|pro"`
+	Tags  []string `csv:"tags,split=|" validate:"max=2,regex=^[a-z]{1,8}$"`
+	Note  string   `csv:"note"`
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func validContact() Contact {
+	return Contact{ID: "c001", Email: "ada@example.com", Site: ptr("https://ada.dev"), Age: ptr(36), Tier: "pro", Tags: []string{"vip"}}
+}
+
+func TestStruct_Valid(t *testing.T) {
+	require.NoError(t, validate.Struct(validContact()))
+
+	// Nil pointers only fail required; omitempty skips empty values.
+	c := validContact()
+	c.Site, c.Age = nil, nil
+	require.NoError(t, validate.Struct(c))
+	c.Site = ptr("")
+	require.NoError(t, validate.Struct(c))
+}
+
+func TestStruct_ReportsEveryFailingRule(t *testing.T) {
+	c := Contact{ID: "", Email: "not-an-email", Site: ptr("/relative"), Age: ptr(12), Tier: "gold", Tags: []string{"ok", "Bad", "x"}}
+
+	err := validate.Struct(c)
+	var errs validate.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, validate.Errors{
+		{Column: "id", Rule: "required", Message: "is required"},
+		{Column: "id", Rule: "len", Message: "length must be 4"},
+		{Column: "email", Rule: "email", Message: "must be a valid email address"},
+		{Column: "site", Rule: "url", Message: "must be a valid URL"},
+		{Column: "age", Rule: "min", Message: "must be at least 18"},
+		{Column: "tier", Rule: "oneof", Message: "must be one of free, pro"},
+		{Column: "tags", Rule: "max", Message: "length must be at most 2"},
+		{Column: "tags", Rule: "regex", Message: "element 1 must match ^[a-z]{1,8}$"},
+	}, errs)
+	require.Contains(t, err.Error(), "id: is required; id: length must be 4; email: must be a valid email address")
+}
+
+func TestFor_InvalidTags(t *testing.T) {
+	type UnknownRule struct {
+		ID string `csv:"id" validate:"uuid"`
+	}
+	_, err := validate.For[UnknownRule]()
+	require.ErrorContains(t, err, `invalid validate tag on field 'id': unknown rule "uuid"`)
+
+	type WrongType struct {
+		Count int `csv:"count" validate:"email"`
+	}
+	_, err = validate.For[WrongType]()
+	require.ErrorContains(t, err, "rule email does not apply to int")
+	require.ErrorContains(t, validate.Struct(WrongType{}), "rule email does not apply to int")
+
+	type BadBound struct {
+		Name string `csv:"name" validate:"min=two"`
+	}
+	_, err = validate.For[BadBound]()
+	require.ErrorContains(t, err, `rule min: invalid length "two"`)
+
+	type BadRegex struct {
+		Name string `csv:"name" validate:"regex=("`
+	}
+	_, err = validate.For[BadRegex]()
+	require.ErrorContains(t, err, "rule regex:")
+}
+
+func TestFor_IsCached(t *testing.T) {
+	first, err := validate.For[Contact]()
+	require.NoError(t, err)
+	second, err := validate.For[Contact]()
+	require.NoError(t, err)
+	require.Same(t, first, second)
+}
+
+func TestAll_CombinesTagRulesAndCustomValidators(t *testing.T) {
+	noVIP := func(c Contact) error {
+		for _, tag := range c.Tags {
+			if tag == "vip" {
+				return errors.New("vip contacts are managed elsewhere")
+			}
+		}
+		return nil
+	}
+	check := validate.All(validate.Struct[Contact], noVIP)
+
+	c := validContact()
+	c.Tier = "gold"
+	err := check(c)
+	require.EqualError(t, err, "tier: must be one of free, pro; vip contacts are managed elsewhere")
+
+	c = validContact()
+	c.Tags = nil
+	require.NoError(t, check(c))
+}